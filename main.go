@@ -22,6 +22,10 @@ import (
 	"github.com/ykgmfq/SystemPub/mqttclient"
 	"github.com/ykgmfq/SystemPub/systemd"
 	"github.com/ykgmfq/SystemPub/zfs"
+	"github.com/ykgmfq/SystemPub/zfs/dataset"
+	"github.com/ykgmfq/SystemPub/zfs/disk"
+	"github.com/ykgmfq/SystemPub/zfs/zevents"
+	"github.com/ykgmfq/SystemPub/zfs/zpool"
 
 	"gopkg.in/yaml.v3"
 )
@@ -98,6 +102,10 @@ func main() {
 	// Logging
 	logger = zerolog.New(os.Stdout).With().Logger()
 	zfs.Logger = logger
+	zevents.Logger = logger
+	zpool.Logger = logger
+	disk.Logger = logger
+	dataset.Logger = logger
 	systemd.Logger = logger
 	mqttclient.Logger = logger
 
@@ -160,8 +168,11 @@ func main() {
 	wdconn := make(chan bool)
 	mqttClient := mqttclient.NewMqttclient(config.MQTTServer, dev)
 	systemdClient := systemd.NewDbusclient(mqttClient.Pubs, dev, 10*time.Minute)
-	zfsServer := zfs.NewZfsServer(mqttClient.Pubs, dev, 20*time.Minute)
+	zfsServer := zfs.NewZfsServer(mqttClient.Pubs, dev, 20*time.Minute, config.ZFS, config.StateDir)
 	mqttClient.ConnListeners = append(mqttClient.ConnListeners, systemdClient.Discover, zfsServer.Discover, wdconn)
+	if config.ZFS.HardwareActions {
+		mqttClient.Commands = zfsServer.Commands
+	}
 
 	go mqttClient.Serve(ctx)
 	go systemdClient.Serve(ctx)
@@ -31,6 +31,29 @@ loglevel: warn
 	assert.Equal(t, zerolog.WarnLevel, config.Loglevel, "Log level mismatch")
 }
 
+// Tests for ZFS settings, which fall back to defaults when not set
+func TestReadConfigZFS(t *testing.T) {
+	configData := `
+zfs:
+  zpool:
+    scrub_max_age_days: 10
+`
+	tempFile, err := os.CreateTemp("", "testconfig.yaml")
+	assert.NoError(t, err, "Failed to create temporary configuration file")
+	defer os.Remove(tempFile.Name())
+	_, err = tempFile.Write([]byte(configData))
+	assert.NoError(t, err, "Failed to write to temporary configuration file")
+	tempFile.Close()
+
+	config, err := readConfig(tempFile.Name())
+	assert.NoError(t, err, "Failed to read config")
+	assert.Equal(t, 10, config.ZFS.Zpool.ScrubMaxAgeDays, "Scrub max age mismatch")
+
+	config, err = readConfig(filepath.Join(os.TempDir(), "does-not-exist.yaml"))
+	assert.NoError(t, err, "Failed to read config")
+	assert.Equal(t, 35, config.ZFS.Zpool.ScrubMaxAgeDays, "Scrub max age default mismatch")
+}
+
 // Tests for loadMQTTPassword
 
 func TestLoadMQTTPassword_NoEnv(t *testing.T) {
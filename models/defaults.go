@@ -10,6 +10,29 @@ func MQTTdefault() MQTT {
 	return MQTT{Host: YAMLURL{&url.URL{Scheme: "mqtt", Host: "localhost:1883"}}}
 }
 
+func ZFSdefault() ZFS {
+	return ZFS{
+		Sanoid: Sanoid{
+			Path:           "sanoid",
+			TimeoutSeconds: 30,
+			Unit:           "sanoid.service",
+			LockDir:        "/var/run/sanoid",
+			MaxAgeMinutes:  60,
+			ConfPath:       "/etc/sanoid/sanoid.conf",
+			BacklogFactor:  2,
+		},
+		Zpool: Zpool{
+			ScrubMaxAgeDays:     35,
+			DataErrorsLimit:     50,
+			ForecastDays:        30,
+			ForecastWarnPercent: 80,
+			Capacity:            CapacityThresholds{Warning: 80, Critical: 90},
+		},
+		Arcstats:  Arcstats{Path: "/proc/spl/kstat/zfs/arcstats"},
+		Userspace: Userspace{Top: 10, QuotaPercent: 90},
+	}
+}
+
 func SystemPubConfigDefault() SystemPubConfig {
-	return SystemPubConfig{MQTTServer: MQTTdefault(), Loglevel: zerolog.InfoLevel}
+	return SystemPubConfig{MQTTServer: MQTTdefault(), Loglevel: zerolog.InfoLevel, ZFS: ZFSdefault(), StateDir: "/var/lib/systempub"}
 }
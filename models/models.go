@@ -33,17 +33,20 @@ type Device struct {
 
 // Sensor configuration for Home Assistant autodiscovery
 type MqttConfig struct {
-	Name                string `json:"name"`
-	DeviceClass         string `json:"device_class,omitempty"`
-	StateTopic          string `json:"state_topic"`
-	UniqueID            string `json:"unique_id"`
-	ValueTemplate       string `json:"value_template,omitempty"`
-	Device              Device `json:"device"`
-	ExpireAfter         int    `json:"expire_after,omitempty"`
-	ForceUpdate         bool   `json:"force_update"`
-	StateClass          string `json:"state_class,omitempty"`
-	UnitOfMeasurement   string `json:"unit_of_measurement,omitempty"`
-	JsonAttributesTopic string `json:"json_attributes_topic,omitempty"`
+	Name                string   `json:"name"`
+	DeviceClass         string   `json:"device_class,omitempty"`
+	StateTopic          string   `json:"state_topic"`
+	UniqueID            string   `json:"unique_id"`
+	ValueTemplate       string   `json:"value_template,omitempty"`
+	Device              Device   `json:"device"`
+	ExpireAfter         int      `json:"expire_after,omitempty"`
+	ForceUpdate         bool     `json:"force_update,omitempty"`
+	StateClass          string   `json:"state_class,omitempty"`
+	UnitOfMeasurement   string   `json:"unit_of_measurement,omitempty"`
+	JsonAttributesTopic string   `json:"json_attributes_topic,omitempty"`
+	EventTypes          []string `json:"event_types,omitempty"`
+	Options             []string `json:"options,omitempty"`
+	CommandTopic        string   `json:"command_topic,omitempty"`
 }
 
 // ZFS pool properties
@@ -78,16 +81,81 @@ type MQTT struct {
 	Password string  `yaml:"password"`
 }
 
+// Capacity percentages at which a pool is in warning or critical state
+type CapacityThresholds struct {
+	Warning  int `yaml:"warning"`
+	Critical int `yaml:"critical"`
+}
+
+// Settings for the zpool provider
+type Zpool struct {
+	ScrubMaxAgeDays     int                           `yaml:"scrub_max_age_days"`
+	DataErrorsLimit     int                           `yaml:"data_errors_limit"`
+	Bays                map[string]string             `yaml:"bays"`                  // Disk serial number to bay label, used in entity names
+	ForecastDays        int                           `yaml:"forecast_days"`         // Allocated space history for the capacity forecast
+	ForecastWarnPercent int                           `yaml:"forecast_warn_percent"` // Capacity of the early warning forecast
+	Capacity            CapacityThresholds            `yaml:"capacity"`
+	PoolCapacity        map[string]CapacityThresholds `yaml:"pool_capacity"` // Thresholds by pool name, unset or invalid values fall back to capacity
+}
+
+// Settings for the ARC statistics provider
+type Arcstats struct {
+	Path string `yaml:"path"`
+}
+
+// Settings for the sanoid provider
+type Sanoid struct {
+	Path           string         `yaml:"path"`            // sanoid executable or a wrapper script
+	TimeoutSeconds int            `yaml:"timeout_seconds"` // Per monitor; --monitor-snapshots can be slow on hosts with many snapshots
+	Unit           string         `yaml:"unit"`            // Service started by the sanoid timer, its last exit is the last run
+	LockDir        string         `yaml:"lock_dir"`
+	MaxAgeMinutes  int            `yaml:"max_age_minutes"` // Window in which sanoid has to run and release its locks
+	ConfPath       string         `yaml:"conf_path"`       // Source of the expected snapshot retention
+	Retention      map[string]int `yaml:"retention"`       // Expected snapshot count by dataset, overrides sanoid.conf
+	BacklogFactor  float64        `yaml:"backlog_factor"`  // Multiple of the expected retention above which a dataset has a snapshot backlog
+}
+
+// Settings for the encryption key provider
+type Encryption struct {
+	Unlocked []string `yaml:"unlocked"` // Encryption roots that should have their key loaded
+}
+
+// Expected property values of the datasets matching a glob, like "tank/prod/**"
+type DriftRule struct {
+	Datasets   string            `yaml:"datasets"`
+	Properties map[string]string `yaml:"properties"`
+}
+
+// Settings for the per-user and per-group space usage provider
+type Userspace struct {
+	Datasets     []string `yaml:"datasets"`
+	Top          int      `yaml:"top"`           // Number of largest users and groups in the attributes
+	QuotaPercent int      `yaml:"quota_percent"` // Quota usage above which the quota problem sensor turns on
+}
+
+// Settings for the ZFS providers
+type ZFS struct {
+	Sanoid          Sanoid      `yaml:"sanoid"`
+	Zpool           Zpool       `yaml:"zpool"`
+	Arcstats        Arcstats    `yaml:"arcstats"`
+	Encryption      Encryption  `yaml:"encryption"`
+	Drift           []DriftRule `yaml:"drift"`
+	Userspace       Userspace   `yaml:"userspace"`
+	HardwareActions bool        `yaml:"hardware_actions"` // Allow Home Assistant to control hardware, like enclosure LEDs
+}
+
 // Application configuration, as read from the configuration file
 type SystemPubConfig struct {
 	MQTTServer MQTT          `yaml:"mqttserver"`
 	Loglevel   zerolog.Level `yaml:"loglevel"`
+	ZFS        ZFS           `yaml:"zfs"`
+	StateDir   string        `yaml:"state_directory"` // Persistent state, like the capacity forecast history
 }
 
 // Entry holds the MQTT config and current state for one sensor.
 type Entry struct {
 	Config     MqttConfig
-	Domain     string // "sensor" or "binary_sensor"
-	Payload    []byte
+	Domain     string // "sensor", "binary_sensor", "event" or "switch"
+	Payload    []byte // nil if the state is not published on every update
 	Attributes []byte // nil if no attributes
 }
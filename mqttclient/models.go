@@ -10,4 +10,5 @@ type Mqttclient struct {
 	Device        models.Device
 	Pubs          chan *paho.Publish
 	ConnListeners []chan bool
+	Commands      chan *paho.Publish // Receives commands from Home Assistant, if set
 }
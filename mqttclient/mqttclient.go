@@ -19,6 +19,9 @@ import (
 
 var Logger zerolog.Logger
 
+// Subscription for the command topics of all entities, like "homeassistant/switch/<unique_id>/set"
+const commandTopicFilter = "homeassistant/+/+/set"
+
 // Replace invalid characters and convert to lowercase for MQTT compatibility
 func NormalizeStr(input string) string {
 	input = strings.ToLower(input)
@@ -46,8 +49,8 @@ func getTlsConfig() (*tls.Config, error) {
 	return &tlsConfig, nil
 }
 
-// Returns a discovery message for a given sensor
-func GetDiscovery(config models.MqttConfig) (*paho.Publish, error) {
+// Returns a discovery message for an entity of the given Home Assistant domain
+func GetDomainDiscovery(domain string, config models.MqttConfig) (*paho.Publish, error) {
 	payload, err := json.Marshal(config)
 	if err != nil {
 		return nil, err
@@ -55,23 +58,30 @@ func GetDiscovery(config models.MqttConfig) (*paho.Publish, error) {
 	return &paho.Publish{
 		QoS:     1,
 		Retain:  true,
-		Topic:   "homeassistant/binary_sensor/" + config.UniqueID + "/config",
+		Topic:   "homeassistant/" + domain + "/" + config.UniqueID + "/config",
 		Payload: payload,
 	}, nil
 }
 
+// Returns the command topic of an entity
+func CommandTopic(domain, uniqueID string) string {
+	return "homeassistant/" + domain + "/" + uniqueID + "/set"
+}
+
+// Reports whether a topic is the command topic of an entity
+func isCommandTopic(topic string) bool {
+	parts := strings.Split(topic, "/")
+	return len(parts) == 4 && parts[0] == "homeassistant" && parts[3] == "set"
+}
+
+// Returns a discovery message for a given sensor
+func GetDiscovery(config models.MqttConfig) (*paho.Publish, error) {
+	return GetDomainDiscovery("binary_sensor", config)
+}
+
 // Returns a discovery message for a numeric sensor entity
 func GetSensorDiscovery(config models.MqttConfig) (*paho.Publish, error) {
-	payload, err := json.Marshal(config)
-	if err != nil {
-		return nil, err
-	}
-	return &paho.Publish{
-		QoS:     1,
-		Retain:  true,
-		Topic:   "homeassistant/sensor/" + config.UniqueID + "/config",
-		Payload: payload,
-	}, nil
+	return GetDomainDiscovery("sensor", config)
 }
 
 // Sensor payload for problem type. Note the inverted logic!
@@ -83,6 +93,11 @@ func ProblemPayload(ok bool) []byte {
 	return payload[ok]
 }
 
+// Sensor payload for binary sensors that are not of problem type.
+func BinaryPayload(on bool) []byte {
+	return ProblemPayload(!on)
+}
+
 // Handles client-side errors.
 func clientError(err error) { Logger.Error().Err(err).Msg("client error") }
 
@@ -111,6 +126,9 @@ func (client Mqttclient) buildClientConfig(tlsConfig *tls.Config) autopaho.Clien
 				{Topic: "homeassistant/status", QoS: 1},
 			},
 		}
+		if client.Commands != nil {
+			sub.Subscriptions = append(sub.Subscriptions, paho.SubscribeOptions{Topic: commandTopicFilter, QoS: 1})
+		}
 		if _, err := cm.Subscribe(context.Background(), sub); err != nil {
 			Logger.Error().Str("mod", "mqtt").Err(err).Msg("Failed to subscribe to homeassistant status")
 		}
@@ -124,6 +142,13 @@ func (client Mqttclient) buildClientConfig(tlsConfig *tls.Config) autopaho.Clien
 			Logger.Info().Str("mod", "mqtt").Msg("Homeassistant is online")
 			client.notifyListeners(true)
 		}
+		if client.Commands != nil && isCommandTopic(pr.Packet.Topic) {
+			select {
+			case client.Commands <- pr.Packet:
+			default:
+				Logger.Warn().Str("mod", "mqtt").Str("topic", pr.Packet.Topic).Msg("Command dropped, previous command still running")
+			}
+		}
 		return true, nil
 	}
 
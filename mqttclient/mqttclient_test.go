@@ -38,11 +38,36 @@ func TestGetDiscovery(t *testing.T) {
 	assert.Equal(t, "Test Sensor", payload["name"])
 }
 
+func TestGetDomainDiscovery(t *testing.T) {
+	config := models.MqttConfig{UniqueID: "test_event", Name: "Test Event", EventTypes: []string{"fault"}}
+
+	discoveryMsg, err := GetDomainDiscovery("event", config)
+	require.NoError(t, err)
+	assert.Equal(t, "homeassistant/event/test_event/config", discoveryMsg.Topic)
+
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(discoveryMsg.Payload, &payload))
+	assert.Equal(t, []any{"fault"}, payload["event_types"])
+}
+
+func TestCommandTopic(t *testing.T) {
+	topic := CommandTopic("switch", "zpool_1_sda_locate")
+	assert.Equal(t, "homeassistant/switch/zpool_1_sda_locate/set", topic)
+	assert.True(t, isCommandTopic(topic))
+	assert.False(t, isCommandTopic("homeassistant/switch/zpool_1_sda_locate/state"))
+	assert.False(t, isCommandTopic("homeassistant/status"))
+}
+
 func TestProblemPayload(t *testing.T) {
 	assert.Equal(t, []byte("OFF"), ProblemPayload(true))
 	assert.Equal(t, []byte("ON"), ProblemPayload(false))
 }
 
+func TestBinaryPayload(t *testing.T) {
+	assert.Equal(t, []byte("ON"), BinaryPayload(true))
+	assert.Equal(t, []byte("OFF"), BinaryPayload(false))
+}
+
 func TestGetTlsConfig(t *testing.T) {
 	cfg, err := getTlsConfig()
 	if err != nil {
@@ -0,0 +1,132 @@
+// Package arcstats provides a ZFS provider that reads ARC and L2ARC statistics from the kstat file.
+package arcstats
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+const gib = float64(1 << 30)
+
+// parseArcstats reads the "name type data" lines of a kstat file into a map.
+func parseArcstats(r io.Reader) (map[string]uint64, error) {
+	stats := make(map[string]uint64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 3 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[2], 10, 64)
+		if err != nil {
+			continue
+		}
+		stats[fields[0]] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(stats) == 0 {
+		return nil, fmt.Errorf("no statistics found")
+	}
+	return stats, nil
+}
+
+// update computes the hit ratio since the baseline sample, once at least minSpan has passed.
+// Earlier samples, like the update right after discovery, keep the baseline, so the ratio never covers a few milliseconds only.
+// Samples without traffic keep the previous ratio, a counter reset starts over.
+func (c *hitCounter) update(hits, misses uint64, now time.Time, minSpan time.Duration) {
+	if c.at.IsZero() || hits < c.hits || misses < c.misses {
+		*c = hitCounter{hits: hits, misses: misses, at: now}
+		return
+	}
+	if now.Sub(c.at) < minSpan {
+		return
+	}
+	dHits, dMisses := hits-c.hits, misses-c.misses
+	if dHits+dMisses == 0 {
+		return
+	}
+	c.ratio = float64(dHits) / float64(dHits+dMisses) * 100
+	c.valid = true
+	c.hits, c.misses, c.at = hits, misses, now
+}
+
+func (c *hitCounter) payload() []byte {
+	if !c.valid {
+		return []byte("None")
+	}
+	return []byte(fmt.Sprintf("%.2f", c.ratio))
+}
+
+// NewArcProvider returns a provider that reads the ARC kstats from the configured path.
+func NewArcProvider(config models.Arcstats, device models.Device, interval time.Duration) *ArcProvider {
+	return &ArcProvider{device: device, interval: interval, path: config.Path}
+}
+
+func (p *ArcProvider) makeEntry(name, key, deviceClass, unit string, payload []byte) models.Entry {
+	uid := mqttclient.NormalizeStr(p.device.Name) + "_" + key
+	cfg := models.MqttConfig{
+		Name:              name,
+		StateTopic:        "homeassistant/sensor/" + uid + "/state",
+		UniqueID:          uid,
+		Device:            p.device,
+		ExpireAfter:       int((p.interval * 2).Seconds()),
+		ForceUpdate:       true,
+		StateClass:        "measurement",
+		DeviceClass:       deviceClass,
+		UnitOfMeasurement: unit,
+	}
+	return models.Entry{Config: cfg, Domain: "sensor", Payload: payload}
+}
+
+func (p *ArcProvider) sizeEntry(name, key string, bytes uint64) models.Entry {
+	return p.makeEntry(name, key, "data_size", "GiB", []byte(fmt.Sprintf("%.2f", float64(bytes)/gib)))
+}
+
+// Entries reads the kstat file and returns the ARC sensors, plus the L2ARC sensors if a cache device is in use.
+func (p *ArcProvider) Entries(_ context.Context) ([]models.Entry, error) {
+	file, err := os.Open(p.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	stats, err := parseArcstats(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", p.path, err)
+	}
+	// OpenZFS 2.2 replaced arc_meta_used with metadata_size
+	meta, ok := stats["arc_meta_used"]
+	if !ok {
+		meta = stats["metadata_size"]
+	}
+	// Half an interval separates the update right after discovery from the next tick, with room for ticker jitter
+	now := time.Now()
+	p.arc.update(stats["hits"], stats["misses"], now, p.interval/2)
+	entries := []models.Entry{
+		p.sizeEntry("ARC size", "arc_size", stats["size"]),
+		p.sizeEntry("ARC target size", "arc_target", stats["c"]),
+		p.sizeEntry("ARC minimum size", "arc_min", stats["c_min"]),
+		p.sizeEntry("ARC maximum size", "arc_max", stats["c_max"]),
+		p.sizeEntry("ARC metadata size", "arc_meta", meta),
+		p.makeEntry("ARC hit ratio", "arc_hit_ratio", "", "%", p.arc.payload()),
+	}
+	if stats["l2_size"] == 0 && stats["l2_hits"]+stats["l2_misses"] == 0 {
+		return entries, nil
+	}
+	p.l2arc.update(stats["l2_hits"], stats["l2_misses"], now, p.interval/2)
+	return append(entries,
+		p.sizeEntry("L2ARC size", "l2arc_size", stats["l2_size"]),
+		p.sizeEntry("L2ARC allocated size", "l2arc_asize", stats["l2_asize"]),
+		p.makeEntry("L2ARC hit ratio", "l2arc_hit_ratio", "", "%", p.l2arc.payload()),
+	), nil
+}
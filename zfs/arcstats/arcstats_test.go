@@ -0,0 +1,87 @@
+package arcstats
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func byUID(entries []models.Entry) map[string]models.Entry {
+	m := map[string]models.Entry{}
+	for _, e := range entries {
+		m[e.Config.UniqueID] = e
+	}
+	return m
+}
+
+func TestParseArcstats(t *testing.T) {
+	file, err := os.Open("arcstats")
+	require.NoError(t, err)
+	defer file.Close()
+	stats, err := parseArcstats(file)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(9523418), stats["hits"])
+	assert.Equal(t, uint64(16845938688), stats["c_max"])
+	assert.NotContains(t, stats, "name")
+}
+
+func TestParseArcstatsEmpty(t *testing.T) {
+	_, err := parseArcstats(strings.NewReader(""))
+	assert.Error(t, err)
+}
+
+func TestHitCounter(t *testing.T) {
+	var c hitCounter
+	start := time.Unix(1000, 0)
+	minSpan := 10 * time.Minute
+	c.update(100, 100, start, minSpan)
+	assert.Equal(t, []byte("None"), c.payload(), "Expected no ratio after the first sample")
+	c.update(101, 100, start.Add(5*time.Millisecond), minSpan)
+	assert.Equal(t, []byte("None"), c.payload(), "Expected no ratio right after the baseline sample")
+	c.update(190, 110, start.Add(20*time.Minute), minSpan)
+	assert.Equal(t, []byte("90.00"), c.payload(), "Expected the ratio since the baseline sample")
+	c.update(190, 110, start.Add(40*time.Minute), minSpan)
+	assert.Equal(t, []byte("90.00"), c.payload(), "Expected ratio to be kept without traffic")
+	c.update(10, 10, start.Add(60*time.Minute), minSpan)
+	assert.Equal(t, []byte("None"), c.payload(), "Expected counter reset to start over")
+}
+
+func TestEntries(t *testing.T) {
+	provider := NewArcProvider(models.Arcstats{Path: "arcstats"}, models.Device{Name: "host"}, 20*time.Minute)
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	sensors := byUID(entries)
+	assert.Len(t, sensors, 9)
+	assert.Equal(t, []byte("6.00"), sensors["host_arc_size"].Payload)
+	assert.Equal(t, []byte("8.00"), sensors["host_arc_target"].Payload)
+	assert.Equal(t, []byte("1.00"), sensors["host_arc_meta"].Payload)
+	assert.Equal(t, "GiB", sensors["host_arc_size"].Config.UnitOfMeasurement)
+	assert.Equal(t, []byte("100.00"), sensors["host_l2arc_size"].Payload)
+	assert.Equal(t, []byte("None"), sensors["host_arc_hit_ratio"].Payload)
+}
+
+func TestEntriesWithoutL2arc(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "arcstats")
+	data := "name type data\nhits 4 10\nmisses 4 5\nsize 4 1073741824\nl2_size 4 0\nl2_hits 4 0\nl2_misses 4 0\n"
+	require.NoError(t, os.WriteFile(path, []byte(data), 0600))
+	provider := NewArcProvider(models.Arcstats{Path: path}, models.Device{Name: "host"}, 20*time.Minute)
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	sensors := byUID(entries)
+	assert.Len(t, sensors, 6)
+	assert.NotContains(t, sensors, "host_l2arc_size")
+	assert.Equal(t, []byte("0.00"), sensors["host_arc_meta"].Payload)
+}
+
+func TestEntriesMissingFile(t *testing.T) {
+	provider := NewArcProvider(models.Arcstats{Path: "does-not-exist"}, models.Device{Name: "host"}, 20*time.Minute)
+	_, err := provider.Entries(context.Background())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,25 @@
+package arcstats
+
+import (
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+// Hit and miss counters of one cache level, with the hit ratio of the last sampling interval
+type hitCounter struct {
+	hits   uint64
+	misses uint64
+	at     time.Time // time of the baseline sample
+	ratio  float64
+	valid  bool // false until two samples with traffic have been taken
+}
+
+// ArcProvider reads the ARC kstats and publishes ARC and L2ARC MQTT sensors for the host.
+type ArcProvider struct {
+	device   models.Device
+	interval time.Duration
+	path     string
+	arc      hitCounter
+	l2arc    hitCounter
+}
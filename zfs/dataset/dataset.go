@@ -0,0 +1,72 @@
+// Package dataset provides ZFS providers for dataset state via `zfs get -j`.
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+var Logger zerolog.Logger
+
+const gib = float64(1 << 30)
+
+// runZfsGet reads properties of all filesystems and volumes.
+func runZfsGet(ctx context.Context, exec func(context.Context, string, ...string) commandExecutor, props ...string) (*zfsGet, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec(ctx, "zfs", "get", "-j", "-p", "-t", "filesystem,volume", strings.Join(props, ",")).Output()
+	if err != nil {
+		return nil, err
+	}
+	var get zfsGet
+	if err := json.Unmarshal(out, &get); err != nil {
+		return nil, err
+	}
+	return &get, nil
+}
+
+// names returns the dataset names in sorted order, so entities are published in a stable order.
+func (g *zfsGet) names() []string {
+	names := make([]string, 0, len(g.Datasets))
+	for name := range g.Datasets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// prop returns the value of a property, or "" if it was not read.
+func (d *zfsDataset) prop(name string) string {
+	return d.Properties[name].Value
+}
+
+func defaultExec(ctx context.Context, name string, arg ...string) commandExecutor {
+	return exec.CommandContext(ctx, name, arg...)
+}
+
+// makeConfig returns the config of a host entity, with a unique ID from the host name and key.
+func makeConfig(name, key, domain, deviceClass string, device models.Device, interval time.Duration) models.MqttConfig {
+	uid := mqttclient.NormalizeStr(device.Name) + "_" + key
+	return models.MqttConfig{
+		Name:        name,
+		StateTopic:  "homeassistant/" + domain + "/" + uid + "/state",
+		UniqueID:    uid,
+		DeviceClass: deviceClass,
+		Device:      device,
+		ExpireAfter: int((interval * 2).Seconds()),
+		ForceUpdate: true,
+	}
+}
+
+// attrTopic returns the attributes topic next to the state topic of an entity.
+func attrTopic(cfg models.MqttConfig) string {
+	return strings.TrimSuffix(cfg.StateTopic, "/state") + "/attributes"
+}
@@ -0,0 +1,172 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// Size suffixes of zfs properties like recordsize, as powers of 1024
+const sizeSuffixes = "BKMGTPE"
+
+// matchDataset reports whether a dataset matches a glob of path.Match.
+// A trailing "/**" matches the dataset itself and all of its descendants.
+func matchDataset(pattern, name string) bool {
+	if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+		if ok, _ := path.Match(prefix, name); ok {
+			return true
+		}
+		for parent := path.Dir(name); parent != "."; parent = path.Dir(parent) {
+			if ok, _ := path.Match(prefix, parent); ok {
+				return true
+			}
+		}
+		return false
+	}
+	ok, _ := path.Match(pattern, name)
+	return ok
+}
+
+// ruleSpecificity ranks how closely a pattern targets a dataset: literal names first, then globs by their literal characters.
+// "/**" counts as a wildcard, so "tank/prod" is more specific than "tank/prod/**", which is more specific than "tank/**".
+func ruleSpecificity(pattern string) int {
+	if !strings.ContainsAny(pattern, "*?[\\") {
+		return 1 << 20
+	}
+	pattern = strings.TrimSuffix(pattern, "/**")
+	literal := 0
+	for _, c := range pattern {
+		if !strings.ContainsRune("*?[]\\", c) {
+			literal++
+		}
+	}
+	return literal
+}
+
+// parseSize reads a size like "131072", "128K" or "1.5M".
+func parseSize(s string) (float64, bool) {
+	s = strings.TrimSuffix(strings.ToUpper(s), "B")
+	exp := 0
+	if s != "" {
+		if i := strings.IndexByte(sizeSuffixes, s[len(s)-1]); i > 0 {
+			exp = i
+			s = s[:len(s)-1]
+		}
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, false
+	}
+	for range exp {
+		value *= 1024
+	}
+	return value, true
+}
+
+// sameValue compares a property value with the expected one, ignoring case and the notation of sizes.
+func sameValue(actual, expected string) bool {
+	if strings.EqualFold(actual, expected) {
+		return true
+	}
+	a, okA := parseSize(actual)
+	e, okE := parseSize(expected)
+	return okA && okE && a == e
+}
+
+// NewDriftProvider returns a provider that checks dataset properties against the configured drift rules.
+func NewDriftProvider(rules []models.DriftRule, device models.Device, interval time.Duration) *DriftProvider {
+	return &DriftProvider{
+		device:   device,
+		interval: interval,
+		rules:    rules,
+		execFn:   defaultExec,
+	}
+}
+
+// findDrift returns the mismatches of the datasets matched by any rule, by pool.
+// If several rules set the same property of a dataset, the most specific one wins, and the first one of equally specific rules.
+// Pools with matched datasets but no mismatches get an empty list.
+func findDrift(get *zfsGet, rules []models.DriftRule) map[string][]driftMismatch {
+	drift := map[string][]driftMismatch{}
+	for _, name := range get.names() {
+		ds := get.Datasets[name]
+		expected := map[string]string{}
+		specificity := map[string]int{}
+		for _, rule := range rules {
+			if !matchDataset(rule.Datasets, name) {
+				continue
+			}
+			if _, ok := drift[ds.Pool]; !ok {
+				drift[ds.Pool] = []driftMismatch{}
+			}
+			rank := ruleSpecificity(rule.Datasets)
+			for prop, value := range rule.Properties {
+				if best, ok := specificity[prop]; !ok || rank > best {
+					expected[prop] = value
+					specificity[prop] = rank
+				}
+			}
+		}
+		props := make([]string, 0, len(expected))
+		for prop := range expected {
+			props = append(props, prop)
+		}
+		slices.Sort(props)
+		for _, prop := range props {
+			actual := ds.prop(prop)
+			// Not applicable, like recordsize on a volume
+			if actual == "-" || actual == "" {
+				continue
+			}
+			if !sameValue(actual, expected[prop]) {
+				drift[ds.Pool] = append(drift[ds.Pool], driftMismatch{name, prop, actual, expected[prop]})
+			}
+		}
+	}
+	return drift
+}
+
+// Entries returns a drift problem sensor per pool with datasets matched by the configured rules.
+func (p *DriftProvider) Entries(ctx context.Context) ([]models.Entry, error) {
+	if len(p.rules) == 0 {
+		return nil, nil
+	}
+	var props []string
+	for _, rule := range p.rules {
+		for prop := range rule.Properties {
+			if !slices.Contains(props, prop) {
+				props = append(props, prop)
+			}
+		}
+	}
+	slices.Sort(props)
+	get, err := runZfsGet(ctx, p.execFn, props...)
+	if err != nil {
+		return nil, err
+	}
+	drift := findDrift(get, p.rules)
+	pools := make([]string, 0, len(drift))
+	for pool := range drift {
+		pools = append(pools, pool)
+	}
+	slices.Sort(pools)
+
+	entries := make([]models.Entry, 0, len(pools))
+	for _, pool := range pools {
+		cfg := makeConfig("Property drift "+pool, "zfs_drift_"+mqttclient.NormalizeStr(pool), "binary_sensor", "problem", p.device, p.interval)
+		cfg.JsonAttributesTopic = attrTopic(cfg)
+		attrs, err := json.Marshal(map[string]any{"mismatches": drift[pool]})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, models.Entry{Config: cfg, Domain: "binary_sensor", Payload: mqttclient.ProblemPayload(len(drift[pool]) == 0), Attributes: attrs})
+	}
+	return entries, nil
+}
@@ -0,0 +1,98 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func TestMatchDataset(t *testing.T) {
+	assert.True(t, matchDataset("tank/prod/*", "tank/prod/db"))
+	assert.False(t, matchDataset("tank/prod/*", "tank/prod"))
+	assert.False(t, matchDataset("tank/prod/*", "tank/prod/db/logs"))
+	assert.True(t, matchDataset("tank/prod/**", "tank/prod"))
+	assert.True(t, matchDataset("tank/prod/**", "tank/prod/db/logs"))
+	assert.False(t, matchDataset("tank/prod/**", "tank/production"))
+	assert.True(t, matchDataset("*", "backup"))
+}
+
+func TestSameValue(t *testing.T) {
+	assert.True(t, sameValue("131072", "128K"))
+	assert.True(t, sameValue("1048576", "1M"))
+	assert.True(t, sameValue("lz4", "LZ4"))
+	assert.False(t, sameValue("16384", "128K"))
+	assert.False(t, sameValue("off", "lz4"))
+}
+
+func TestDriftEntries(t *testing.T) {
+	rules := []models.DriftRule{
+		{Datasets: "tank/prod/**", Properties: map[string]string{"compression": "lz4", "sync": "standard"}},
+		{Datasets: "tank/prod", Properties: map[string]string{"recordsize": "1M"}},
+		{Datasets: "tank/prod/*", Properties: map[string]string{"recordsize": "128K"}},
+		{Datasets: "backup", Properties: map[string]string{"compression": "zstd"}},
+	}
+	provider := NewDriftProvider(rules, models.Device{Name: "host"}, 20*time.Minute)
+	var args []string
+	fixture := zfsFixtureExec(t, "zfsget_drift.json")
+	provider.execFn = func(ctx context.Context, name string, arg ...string) commandExecutor {
+		args = arg
+		return fixture(ctx, name, arg...)
+	}
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "compression,recordsize,sync", args[len(args)-1])
+	require.Len(t, entries, 2, "Expected no sensor for pools without matched datasets")
+
+	backup := entries[0]
+	assert.Equal(t, "host_zfs_drift_backup", backup.Config.UniqueID)
+	assert.Equal(t, []byte("OFF"), backup.Payload)
+
+	tank := entries[1]
+	assert.Equal(t, "Property drift tank", tank.Config.Name)
+	assert.Equal(t, []byte("ON"), tank.Payload)
+	var attrs struct {
+		Mismatches []driftMismatch `json:"mismatches"`
+	}
+	require.NoError(t, json.Unmarshal(tank.Attributes, &attrs))
+	assert.Equal(t, []driftMismatch{
+		{"tank/prod/db", "compression", "off", "lz4"},
+		{"tank/prod/db", "recordsize", "16384", "128K"},
+		{"tank/prod/db", "sync", "disabled", "standard"},
+	}, attrs.Mismatches, "Expected volumes to skip recordsize")
+}
+
+func TestRuleSpecificity(t *testing.T) {
+	assert.Greater(t, ruleSpecificity("tank/prod"), ruleSpecificity("tank/prod/*"))
+	assert.Greater(t, ruleSpecificity("tank/prod/*"), ruleSpecificity("tank/prod/**"))
+	assert.Greater(t, ruleSpecificity("tank/prod/**"), ruleSpecificity("tank/**"))
+	assert.Greater(t, ruleSpecificity("tank/**"), ruleSpecificity("*"))
+}
+
+func TestDriftOverlappingRules(t *testing.T) {
+	get, err := runZfsGet(context.Background(), zfsFixtureExec(t, "zfsget_drift.json"), "compression", "sync")
+	require.NoError(t, err)
+	drift := findDrift(get, []models.DriftRule{
+		{Datasets: "tank/**", Properties: map[string]string{"compression": "zstd"}},
+		{Datasets: "tank/prod/**", Properties: map[string]string{"compression": "lz4", "sync": "standard"}},
+		{Datasets: "tank/prod/*", Properties: map[string]string{"compression": "lz4"}},
+		{Datasets: "tank/prod/db", Properties: map[string]string{"sync": "standard"}},
+	})
+	assert.Equal(t, []driftMismatch{
+		{"tank", "compression", "lz4", "zstd"},
+		{"tank/prod/db", "compression", "off", "lz4"},
+		{"tank/prod/db", "sync", "disabled", "standard"},
+	}, drift["tank"], "Expected one mismatch per dataset and property, from the most specific rule")
+}
+
+func TestDriftEntriesWithoutRules(t *testing.T) {
+	provider := NewDriftProvider(nil, models.Device{Name: "host"}, 20*time.Minute)
+	provider.execFn = nil // must not run zfs
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
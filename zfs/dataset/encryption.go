@@ -0,0 +1,66 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// Key states of an encryption root, as options of its enum sensor
+var keyStates = []string{"available", "unavailable"}
+
+// NewEncryptionProvider returns a provider for the key status of encryption roots.
+func NewEncryptionProvider(config models.Encryption, device models.Device, interval time.Duration) *EncryptionProvider {
+	return &EncryptionProvider{
+		device:   device,
+		interval: interval,
+		unlocked: config.Unlocked,
+		execFn:   defaultExec,
+	}
+}
+
+// Entries returns a key status sensor per encryption root and the problem sensor for configured roots that are locked.
+func (p *EncryptionProvider) Entries(ctx context.Context) ([]models.Entry, error) {
+	get, err := runZfsGet(ctx, p.execFn, "encryptionroot", "keystatus", "keylocation", "keyformat")
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.Entry
+	for _, name := range get.names() {
+		ds := get.Datasets[name]
+		if ds.prop("encryptionroot") != name {
+			continue
+		}
+		cfg := makeConfig("Key status "+name, "keystatus_"+mqttclient.NormalizeStr(name), "sensor", "enum", p.device, p.interval)
+		cfg.Options = keyStates
+		cfg.JsonAttributesTopic = attrTopic(cfg)
+		attrs, err := json.Marshal(map[string]string{
+			"keylocation": ds.prop("keylocation"),
+			"keyformat":   ds.prop("keyformat"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, models.Entry{Config: cfg, Domain: "sensor", Payload: []byte(ds.prop("keystatus")), Attributes: attrs})
+	}
+
+	// Configured roots that are missing, like on a pool that is not imported, are locked as well
+	locked := []string{}
+	for _, name := range p.unlocked {
+		if ds, ok := get.Datasets[name]; !ok || ds.prop("keystatus") != "available" {
+			locked = append(locked, name)
+		}
+	}
+	slices.Sort(locked)
+	cfg := makeConfig("Encryption keys locked", "encryption_locked", "binary_sensor", "problem", p.device, p.interval)
+	cfg.JsonAttributesTopic = attrTopic(cfg)
+	attrs, err := json.Marshal(map[string]any{"locked": locked})
+	if err != nil {
+		return nil, err
+	}
+	return append(entries, models.Entry{Config: cfg, Domain: "binary_sensor", Payload: mqttclient.ProblemPayload(len(locked) == 0), Attributes: attrs}), nil
+}
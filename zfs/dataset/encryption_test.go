@@ -0,0 +1,71 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+type mockZfsCmd struct {
+	data []byte
+	err  error
+}
+
+func (m *mockZfsCmd) Output() ([]byte, error) { return m.data, m.err }
+
+func zfsFixtureExec(t *testing.T, path string) func(context.Context, string, ...string) commandExecutor {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return func(_ context.Context, _ string, _ ...string) commandExecutor { return &mockZfsCmd{data: data} }
+}
+
+func TestEncryptionEntries(t *testing.T) {
+	config := models.Encryption{Unlocked: []string{"tank/vault", "tank/secure", "backup/offsite"}}
+	provider := NewEncryptionProvider(config, models.Device{Name: "host"}, 20*time.Minute)
+	provider.execFn = zfsFixtureExec(t, "zfsget_keys.json")
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	require.Len(t, entries, 3, "Expected one sensor per encryption root and the problem sensor")
+
+	secure := entries[0]
+	assert.Equal(t, "host_keystatus_tank-secure", secure.Config.UniqueID)
+	assert.Equal(t, "Key status tank/secure", secure.Config.Name)
+	assert.Equal(t, keyStates, secure.Config.Options)
+	assert.Equal(t, []byte("available"), secure.Payload)
+	assert.JSONEq(t, `{"keylocation": "file:///etc/zfs/keys/secure.key", "keyformat": "raw"}`, string(secure.Attributes))
+	assert.Equal(t, []byte("unavailable"), entries[1].Payload)
+
+	locked := entries[2]
+	assert.Equal(t, "homeassistant/binary_sensor/host_encryption_locked/attributes", locked.Config.JsonAttributesTopic)
+	assert.Equal(t, []byte("ON"), locked.Payload)
+	var attrs map[string][]string
+	require.NoError(t, json.Unmarshal(locked.Attributes, &attrs))
+	assert.Equal(t, []string{"backup/offsite", "tank/vault"}, attrs["locked"], "Expected missing roots to count as locked")
+}
+
+func TestEncryptionEntriesNothingConfigured(t *testing.T) {
+	provider := NewEncryptionProvider(models.Encryption{}, models.Device{Name: "host"}, 20*time.Minute)
+	provider.execFn = zfsFixtureExec(t, "zfsget_keys.json")
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	locked := entries[len(entries)-1]
+	assert.Equal(t, []byte("OFF"), locked.Payload)
+	assert.JSONEq(t, `{"locked": []}`, string(locked.Attributes))
+}
+
+func TestEncryptionEntriesError(t *testing.T) {
+	provider := NewEncryptionProvider(models.Encryption{}, models.Device{Name: "host"}, 20*time.Minute)
+	provider.execFn = func(_ context.Context, _ string, _ ...string) commandExecutor {
+		return &mockZfsCmd{err: errors.New("zfs not found")}
+	}
+	_, err := provider.Entries(context.Background())
+	assert.Error(t, err)
+}
@@ -0,0 +1,87 @@
+package dataset
+
+import (
+	"context"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+type commandExecutor interface {
+	Output() ([]byte, error)
+}
+
+// One property of `zfs get -j`
+type zfsProperty struct {
+	Value  string `json:"value"`
+	Source struct {
+		Type string `json:"type"`
+		Data string `json:"data"`
+	} `json:"source"`
+}
+
+type zfsDataset struct {
+	Name       string                 `json:"name"`
+	Type       string                 `json:"type"`
+	Pool       string                 `json:"pool"`
+	Properties map[string]zfsProperty `json:"properties"`
+}
+
+// Output of `zfs get -j` and `zfs list -j`
+type zfsGet struct {
+	Datasets map[string]*zfsDataset `json:"datasets"`
+}
+
+// EncryptionProvider publishes the key status of encryption roots and whether the configured ones are unlocked.
+type EncryptionProvider struct {
+	device   models.Device
+	interval time.Duration
+	unlocked []string // encryption roots that should have their key loaded
+	execFn   func(context.Context, string, ...string) commandExecutor
+}
+
+// One line of /proc/self/mountinfo
+type mountEntry struct {
+	Mountpoint string
+	FSType     string
+	Source     string
+}
+
+// MountProvider checks that datasets which should be mounted are mounted and visible.
+type MountProvider struct {
+	device    models.Device
+	interval  time.Duration
+	mountinfo string
+	execFn    func(context.Context, string, ...string) commandExecutor
+}
+
+// A dataset property that differs from the configured value
+type driftMismatch struct {
+	Dataset  string `json:"dataset"`
+	Property string `json:"property"`
+	Actual   string `json:"actual"`
+	Expected string `json:"expected"`
+}
+
+// DriftProvider compares dataset properties with the configured values and publishes a drift sensor per pool.
+type DriftProvider struct {
+	device   models.Device
+	interval time.Duration
+	rules    []models.DriftRule
+	execFn   func(context.Context, string, ...string) commandExecutor
+}
+
+// Space used by one user or group, from `zfs userspace` or `zfs groupspace`
+type spaceUsage struct {
+	Name  string
+	Used  int64
+	Quota int64 // 0 if no quota is set
+}
+
+// UserspaceProvider publishes the largest users and groups and the quota usage of the configured datasets.
+type UserspaceProvider struct {
+	device   models.Device
+	interval time.Duration
+	config   models.Userspace
+	execFn   func(context.Context, string, ...string) commandExecutor
+}
@@ -0,0 +1,151 @@
+package dataset
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// runZfsList reads the mount properties of all filesystems.
+func runZfsList(ctx context.Context, exec func(context.Context, string, ...string) commandExecutor) (*zfsGet, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec(ctx, "zfs", "list", "-j", "-p", "-t", "filesystem", "-o", "name,mounted,canmount,mountpoint").Output()
+	if err != nil {
+		return nil, err
+	}
+	var list zfsGet
+	if err := json.Unmarshal(out, &list); err != nil {
+		return nil, err
+	}
+	return &list, nil
+}
+
+// unescapeMountinfo decodes the octal escapes of mountinfo paths, like "\040" for a space.
+func unescapeMountinfo(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// parseMountinfo reads the mounts in mount order, which is also the stacking order.
+func parseMountinfo(r io.Reader) ([]mountEntry, error) {
+	var mounts []mountEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// id parent major:minor root mountpoint options [optional fields...] - fstype source superoptions
+		fields := strings.Fields(scanner.Text())
+		sep := -1
+		for i, f := range fields {
+			if f == "-" {
+				sep = i
+				break
+			}
+		}
+		if sep < 5 || sep+2 >= len(fields) {
+			continue
+		}
+		mounts = append(mounts, mountEntry{
+			Mountpoint: unescapeMountinfo(fields[4]),
+			FSType:     fields[sep+1],
+			Source:     unescapeMountinfo(fields[sep+2]),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// covers reports whether a mount at dir hides the path p.
+func covers(dir, p string) bool {
+	return dir == p || dir == "/" || strings.HasPrefix(p, dir+"/")
+}
+
+// checkMount returns "unmounted" or "shadowed" for a dataset that is not visible at its mountpoint, or "" if it is.
+// A dataset is shadowed if another filesystem was mounted on its mountpoint or one of its parents afterwards.
+func checkMount(name, mountpoint string, mounts []mountEntry) string {
+	last := -1
+	for i, m := range mounts {
+		if m.FSType == "zfs" && m.Source == name && m.Mountpoint == mountpoint {
+			last = i
+		}
+	}
+	if last < 0 {
+		return "unmounted"
+	}
+	for _, m := range mounts[last+1:] {
+		if covers(m.Mountpoint, mountpoint) {
+			return "shadowed"
+		}
+	}
+	return ""
+}
+
+// NewMountProvider returns a provider that compares the mounted datasets with /proc/self/mountinfo.
+func NewMountProvider(device models.Device, interval time.Duration) *MountProvider {
+	return &MountProvider{
+		device:    device,
+		interval:  interval,
+		mountinfo: "/proc/self/mountinfo",
+		execFn:    defaultExec,
+	}
+}
+
+// Entries returns the problem sensor for filesystems with canmount=on that are not mounted or are shadowed.
+// ZFS decides whether a filesystem is mounted; the mount table whether a mounted filesystem is visible.
+// Filesystems with a legacy mountpoint or none at all are left to the administrator.
+func (p *MountProvider) Entries(ctx context.Context) ([]models.Entry, error) {
+	list, err := runZfsList(ctx, p.execFn)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(p.mountinfo)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	mounts, err := parseMountinfo(file)
+	if err != nil {
+		return nil, err
+	}
+
+	problems := map[string][]string{"unmounted": {}, "shadowed": {}}
+	for _, name := range list.names() {
+		ds := list.Datasets[name]
+		mountpoint := ds.prop("mountpoint")
+		if ds.prop("canmount") != "on" || !path.IsAbs(mountpoint) {
+			continue
+		}
+		reason := "unmounted"
+		if ds.prop("mounted") == "yes" {
+			reason = checkMount(name, mountpoint, mounts)
+		}
+		if reason != "" {
+			problems[reason] = append(problems[reason], name)
+		}
+	}
+	cfg := makeConfig("Datasets not mounted", "zfs_mounts", "binary_sensor", "problem", p.device, p.interval)
+	cfg.JsonAttributesTopic = attrTopic(cfg)
+	attrs, err := json.Marshal(problems)
+	if err != nil {
+		return nil, err
+	}
+	ok := len(problems["unmounted"])+len(problems["shadowed"]) == 0
+	return []models.Entry{{Config: cfg, Domain: "binary_sensor", Payload: mqttclient.ProblemPayload(ok), Attributes: attrs}}, nil
+}
@@ -0,0 +1,58 @@
+package dataset
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func TestParseMountinfo(t *testing.T) {
+	file, err := os.Open("mountinfo")
+	require.NoError(t, err)
+	defer file.Close()
+	mounts, err := parseMountinfo(file)
+	require.NoError(t, err)
+	require.Len(t, mounts, 9)
+	assert.Equal(t, mountEntry{Mountpoint: "/tank/my photos", FSType: "zfs", Source: "tank/photos"}, mounts[6])
+	assert.Equal(t, "tmpfs", mounts[8].FSType)
+}
+
+func TestCheckMount(t *testing.T) {
+	mounts, err := parseMountinfo(strings.NewReader(
+		"41 22 0:38 / /tank rw shared:20 - zfs tank rw\n" +
+			"42 41 0:39 / /tank/a rw shared:21 - zfs tank/a rw\n" +
+			"43 22 0:40 / /tank rw - tmpfs tmpfs rw\n" +
+			"44 43 0:41 / /tank/b rw - zfs tank/b rw\n"))
+	require.NoError(t, err)
+	assert.Equal(t, "shadowed", checkMount("tank/a", "/tank/a", mounts), "Expected a mount on a parent to shadow the dataset")
+	assert.Equal(t, "", checkMount("tank/b", "/tank/b", mounts))
+	assert.Equal(t, "unmounted", checkMount("tank/c", "/tank/c", mounts))
+	assert.Equal(t, "", checkMount("tank/b", "/tank/b", append(mounts, mountEntry{"/tank/bc", "tmpfs", "tmpfs"})), "Expected sibling paths not to shadow")
+}
+
+func TestMountEntries(t *testing.T) {
+	provider := NewMountProvider(models.Device{Name: "host"}, 20*time.Minute)
+	provider.execFn = zfsFixtureExec(t, "zfslist_mounts.json")
+	provider.mountinfo = "mountinfo"
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "host_zfs_mounts", entries[0].Config.UniqueID)
+	assert.Equal(t, []byte("ON"), entries[0].Payload)
+	// tank/docs is in the mount table, but ZFS reports it as not mounted
+	assert.JSONEq(t, `{"unmounted": ["tank/docs"], "shadowed": ["tank/backup"]}`, string(entries[0].Attributes))
+}
+
+func TestMountEntriesMissingMountinfo(t *testing.T) {
+	provider := NewMountProvider(models.Device{Name: "host"}, 20*time.Minute)
+	provider.execFn = zfsFixtureExec(t, "zfslist_mounts.json")
+	provider.mountinfo = "does-not-exist"
+	_, err := provider.Entries(context.Background())
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
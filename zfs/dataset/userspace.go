@@ -0,0 +1,154 @@
+package dataset
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// runSpace runs `zfs userspace` or `zfs groupspace` on a dataset and returns the usage sorted by space used, largest first.
+func runSpace(ctx context.Context, exec func(context.Context, string, ...string) commandExecutor, subcommand, dataset string) ([]spaceUsage, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec(ctx, "zfs", subcommand, "-H", "-p", "-o", "name,used,quota", dataset).Output()
+	if err != nil {
+		return nil, fmt.Errorf("zfs %s %s: %w", subcommand, dataset, err)
+	}
+	return parseSpace(out), nil
+}
+
+// parseSpace reads the tab-separated name, used and quota columns. Quotas that are not set read "none".
+func parseSpace(out []byte) []spaceUsage {
+	var usage []spaceUsage
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) != 3 {
+			continue
+		}
+		used, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		quota, _ := strconv.ParseInt(fields[2], 10, 64)
+		usage = append(usage, spaceUsage{Name: fields[0], Used: used, Quota: quota})
+	}
+	slices.SortStableFunc(usage, func(a, b spaceUsage) int { return cmp.Compare(b.Used, a.Used) })
+	return usage
+}
+
+// topUsage returns the n largest consumers for the attributes, with their usage in GiB.
+func topUsage(usage []spaceUsage, n int) []map[string]any {
+	top := make([]map[string]any, 0, min(n, len(usage)))
+	for _, u := range usage[:min(n, len(usage))] {
+		top = append(top, map[string]any{"name": u.Name, "used": gibStr(u.Used)})
+	}
+	return top
+}
+
+func gibStr(bytes int64) string {
+	return fmt.Sprintf("%.2f", float64(bytes)/gib)
+}
+
+// NewUserspaceProvider returns a provider for the space usage of users and groups on the configured datasets.
+func NewUserspaceProvider(config models.Userspace, device models.Device, interval time.Duration) *UserspaceProvider {
+	return &UserspaceProvider{
+		device:   device,
+		interval: interval,
+		config:   config,
+		execFn:   defaultExec,
+	}
+}
+
+// sizeEntry returns a data size sensor in GiB.
+func (p *UserspaceProvider) sizeEntry(name, key string, bytes int64) models.Entry {
+	cfg := makeConfig(name, key, "sensor", "data_size", p.device, p.interval)
+	cfg.StateClass = "measurement"
+	cfg.UnitOfMeasurement = "GiB"
+	return models.Entry{Config: cfg, Domain: "sensor", Payload: []byte(gibStr(bytes))}
+}
+
+// datasetEntries constructs the usage sensor, the used and quota sensors per user with a quota, and the quota problem sensor of one dataset.
+func (p *UserspaceProvider) datasetEntries(dataset string, users, groups []spaceUsage) ([]models.Entry, error) {
+	key := mqttclient.NormalizeStr(dataset)
+	var total int64
+	for _, u := range users {
+		total += u.Used
+	}
+	usage := p.sizeEntry("User space "+dataset, "userspace_"+key, total)
+	usage.Config.JsonAttributesTopic = attrTopic(usage.Config)
+	attrs, err := json.Marshal(map[string]any{
+		"top_users":  topUsage(users, p.config.Top),
+		"top_groups": topUsage(groups, p.config.Top),
+	})
+	if err != nil {
+		return nil, err
+	}
+	usage.Attributes = attrs
+	entries := []models.Entry{usage}
+
+	over := []map[string]any{}
+	check := func(kind string, u spaceUsage) {
+		percent := float64(u.Used) / float64(u.Quota) * 100
+		if percent > float64(p.config.QuotaPercent) {
+			over = append(over, map[string]any{"name": u.Name, "type": kind, "percent": fmt.Sprintf("%.1f", percent)})
+		}
+	}
+	for _, u := range users {
+		if u.Quota == 0 {
+			continue
+		}
+		userKey := key + "_" + mqttclient.NormalizeStr(u.Name)
+		entries = append(entries,
+			p.sizeEntry(dataset+" "+u.Name+" used", "userspace_"+userKey+"_used", u.Used),
+			p.sizeEntry(dataset+" "+u.Name+" quota", "userspace_"+userKey+"_quota", u.Quota),
+		)
+		check("user", u)
+	}
+	for _, g := range groups {
+		if g.Quota != 0 {
+			check("group", g)
+		}
+	}
+	cfg := makeConfig("Quota exceeded "+dataset, "quota_"+key, "binary_sensor", "problem", p.device, p.interval)
+	cfg.JsonAttributesTopic = attrTopic(cfg)
+	attrs, err = json.Marshal(map[string]any{"threshold": p.config.QuotaPercent, "over": over})
+	if err != nil {
+		return nil, err
+	}
+	return append(entries, models.Entry{Config: cfg, Domain: "binary_sensor", Payload: mqttclient.ProblemPayload(len(over) == 0), Attributes: attrs}), nil
+}
+
+// Entries runs `zfs userspace` and `zfs groupspace` on every configured dataset.
+// Datasets that cannot be read are skipped, so a typo in the configuration does not hide the others.
+func (p *UserspaceProvider) Entries(ctx context.Context) ([]models.Entry, error) {
+	var entries []models.Entry
+	for _, dataset := range p.config.Datasets {
+		users, err := runSpace(ctx, p.execFn, "userspace", dataset)
+		if err != nil {
+			Logger.Warn().Str("mod", "dataset").Err(err).Msg("Could not read user space")
+			continue
+		}
+		groups, err := runSpace(ctx, p.execFn, "groupspace", dataset)
+		if err != nil {
+			Logger.Warn().Str("mod", "dataset").Err(err).Msg("Could not read group space")
+			continue
+		}
+		datasetEntries, err := p.datasetEntries(dataset, users, groups)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, datasetEntries...)
+	}
+	return entries, nil
+}
@@ -0,0 +1,67 @@
+package dataset
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func TestParseSpace(t *testing.T) {
+	out, err := os.ReadFile("zfsuserspace.txt")
+	require.NoError(t, err)
+	usage := parseSpace(out)
+	require.Len(t, usage, 4)
+	assert.Equal(t, spaceUsage{Name: "alice", Used: 53687091200, Quota: 64424509440}, usage[0])
+	assert.Equal(t, "carol", usage[1].Name, "Expected usage sorted by space used")
+	assert.Equal(t, int64(0), usage[3].Quota)
+}
+
+func TestUserspaceEntries(t *testing.T) {
+	users, err := os.ReadFile("zfsuserspace.txt")
+	require.NoError(t, err)
+	config := models.ZFSdefault().Userspace
+	config.Datasets = []string{"tank/home", "tank/missing"}
+	config.Top = 2
+	provider := NewUserspaceProvider(config, models.Device{Name: "host"}, 20*time.Minute)
+	provider.execFn = func(_ context.Context, _ string, arg ...string) commandExecutor {
+		if arg[len(arg)-1] == "tank/missing" {
+			return &mockZfsCmd{err: errors.New("dataset does not exist")}
+		}
+		if arg[0] == "groupspace" {
+			return &mockZfsCmd{data: []byte("users\t66571993088\t75161927680\n")}
+		}
+		return &mockZfsCmd{data: users}
+	}
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	require.Len(t, entries, 6, "Expected usage, used and quota for two users with quotas, and the problem sensor")
+
+	usage := entries[0]
+	assert.Equal(t, "host_userspace_tank-home", usage.Config.UniqueID)
+	assert.Equal(t, []byte("63.00"), usage.Payload)
+	assert.JSONEq(t, `{
+		"top_users": [{"name": "alice", "used": "50.00"}, {"name": "carol", "used": "10.00"}],
+		"top_groups": [{"name": "users", "used": "62.00"}]
+	}`, string(usage.Attributes))
+
+	assert.Equal(t, "host_userspace_tank-home_alice_used", entries[1].Config.UniqueID)
+	assert.Equal(t, "tank/home alice quota", entries[2].Config.Name)
+	assert.Equal(t, []byte("60.00"), entries[2].Payload)
+
+	quota := entries[5]
+	assert.Equal(t, "host_quota_tank-home", quota.Config.UniqueID)
+	assert.Equal(t, []byte("ON"), quota.Payload)
+	var attrs struct {
+		Over []map[string]string `json:"over"`
+	}
+	require.NoError(t, json.Unmarshal(quota.Attributes, &attrs))
+	assert.Equal(t, []map[string]string{{"name": "carol", "type": "user", "percent": "100.0"}}, attrs.Over,
+		"Expected alice at 83% and the group at 89% to stay below the threshold")
+}
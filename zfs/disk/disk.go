@@ -0,0 +1,183 @@
+// Package disk maps ZFS leaf vdevs to the block devices and sysfs entries of the physical disks.
+package disk
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSlot is returned for disks that are not in a slot of an enclosure.
+var ErrNoSlot = errors.New("disk is not in an enclosure slot")
+
+// Resolver looks up block devices below a root directory, which is "/" except in tests.
+type Resolver struct {
+	Root string
+}
+
+// NewResolver returns a resolver for the running system.
+func NewResolver() Resolver {
+	return Resolver{Root: "/"}
+}
+
+// path returns an absolute system path below the root.
+func (r Resolver) path(elem ...string) string {
+	return filepath.Join(append([]string{r.Root}, elem...)...)
+}
+
+// BlockDevice returns the kernel name of the whole disk behind a vdev path, like "sda" for "/dev/sda1"
+// or "nvme0n1" for a by-id link to "/dev/nvme0n1p2".
+func (r Resolver) BlockDevice(devPath string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(r.path(devPath))
+	if err != nil {
+		return "", err
+	}
+	name := filepath.Base(resolved)
+	sysPath, err := filepath.EvalSymlinks(r.path("sys/class/block", name))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(sysPath, "partition")); err == nil {
+		return filepath.Base(filepath.Dir(sysPath)), nil
+	}
+	return name, nil
+}
+
+// DevPath returns the device node of a block device, like "/dev/sda".
+func DevPath(name string) string {
+	return "/dev/" + name
+}
+
+// Identity describes the physical disk behind a block device. Fields the system does not expose stay empty.
+type Identity struct {
+	Model      string
+	Serial     string
+	WWN        string
+	Size       int64 // bytes
+	Rotational bool
+	Enclosure  string
+	Slot       string
+}
+
+// readAttr returns a trimmed sysfs attribute, or "" if it does not exist.
+func (r Resolver) readAttr(elem ...string) string {
+	data, err := os.ReadFile(r.path(elem...))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// byIDLinks returns the names of the /dev/disk/by-id links to a block device.
+func (r Resolver) byIDLinks(name string) []string {
+	target, err := filepath.EvalSymlinks(r.path("dev", name))
+	if err != nil {
+		return nil
+	}
+	links, err := os.ReadDir(r.path("dev/disk/by-id"))
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, link := range links {
+		if resolved, err := filepath.EvalSymlinks(r.path("dev/disk/by-id", link.Name())); err == nil && resolved == target {
+			names = append(names, link.Name())
+		}
+	}
+	return names
+}
+
+// slotDir returns the /sys/class/enclosure component that holds a disk, or "" if the disk is not in an enclosure.
+func (r Resolver) slotDir(name string) string {
+	device, err := filepath.EvalSymlinks(r.path("sys/block", name, "device"))
+	if err != nil {
+		return ""
+	}
+	components, _ := filepath.Glob(r.path("sys/class/enclosure", "*", "*", "device"))
+	for _, component := range components {
+		if resolved, err := filepath.EvalSymlinks(component); err == nil && resolved == device {
+			return filepath.Dir(component)
+		}
+	}
+	return ""
+}
+
+// enclosureSlot returns the enclosure and slot that hold a disk.
+func (r Resolver) enclosureSlot(name string) (string, string) {
+	dir := r.slotDir(name)
+	if dir == "" {
+		return "", ""
+	}
+	slot := filepath.Base(dir)
+	if data, err := os.ReadFile(filepath.Join(dir, "slot")); err == nil {
+		slot = strings.TrimSpace(string(data))
+	}
+	return filepath.Base(filepath.Dir(dir)), slot
+}
+
+// Suspended reports whether the kernel has runtime-suspended a disk, so that it is spun down without any I/O to check.
+func (r Resolver) Suspended(name string) bool {
+	return r.readAttr("sys/block", name, "device/power/runtime_status") == "suspended"
+}
+
+// Locate reads the locate LED of the enclosure slot that holds a disk.
+func (r Resolver) Locate(name string) (bool, error) {
+	dir := r.slotDir(name)
+	if dir == "" {
+		return false, ErrNoSlot
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "locate"))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(data)) == "1", nil
+}
+
+// SetLocate switches the locate LED of the enclosure slot that holds a disk.
+func (r Resolver) SetLocate(name string, on bool) error {
+	dir := r.slotDir(name)
+	if dir == "" {
+		return ErrNoSlot
+	}
+	value := "0"
+	if on {
+		value = "1"
+	}
+	return os.WriteFile(filepath.Join(dir, "locate"), []byte(value), 0)
+}
+
+// Identity reads the identity of a whole disk, like "sda", from /sys/block, /dev/disk/by-id and /sys/class/enclosure.
+func (r Resolver) Identity(name string) (Identity, error) {
+	if _, err := os.Stat(r.path("sys/block", name)); err != nil {
+		return Identity{}, err
+	}
+	id := Identity{
+		Model:      r.readAttr("sys/block", name, "device/model"),
+		Serial:     r.readAttr("sys/block", name, "device/serial"),
+		Rotational: r.readAttr("sys/block", name, "queue/rotational") == "1",
+	}
+	if sectors, err := strconv.ParseInt(r.readAttr("sys/block", name, "size"), 10, 64); err == nil {
+		id.Size = sectors * 512 // sysfs counts 512-byte sectors regardless of the logical block size
+	}
+	for _, link := range r.byIDLinks(name) {
+		if wwn, ok := strings.CutPrefix(link, "wwn-"); ok && id.WWN == "" {
+			id.WWN = wwn
+		}
+		// ATA and NVMe links are named <bus>-<model>_<serial>
+		if (strings.HasPrefix(link, "ata-") || strings.HasPrefix(link, "nvme-")) && !strings.HasPrefix(link, "nvme-eui.") && id.Serial == "" {
+			if i := strings.LastIndex(link, "_"); i >= 0 {
+				id.Serial = link[i+1:]
+			}
+		}
+	}
+	if id.WWN == "" {
+		id.WWN = r.readAttr("sys/block", name, "wwid")
+	}
+	if id.WWN == "" {
+		id.WWN = r.readAttr("sys/block", name, "device/wwid")
+	}
+	id.Enclosure, id.Slot = r.enclosureSlot(name)
+	return id, nil
+}
@@ -0,0 +1,163 @@
+package disk
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// makeSysfs builds a fake /dev and /sys tree with a partitioned SATA disk, a partitioned NVMe disk and a whole SATA disk.
+func makeSysfs(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	mkfile := func(path, content string) {
+		full := filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+		require.NoError(t, os.WriteFile(full, []byte(content), 0644))
+	}
+	symlink := func(target, path string) {
+		full := filepath.Join(root, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(full), 0755))
+		require.NoError(t, os.Symlink(target, full))
+	}
+	for _, dev := range []string{"sda", "sda1", "sdb", "nvme0n1", "nvme0n1p2"} {
+		mkfile("dev/"+dev, "")
+	}
+	symlink("../../sda1", "dev/disk/by-id/ata-WDC_WD40EFRX-68N32N0_WD-WCC7K0000001-part1")
+	symlink("../../nvme0n1p2", "dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNX0T000001-part2")
+
+	for _, blk := range []struct{ name, dir string }{
+		{"sda", "devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0/block/sda"},
+		{"sda1", "devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0/block/sda/sda1"},
+		{"sdb", "devices/pci0000:00/0000:00:17.0/ata2/host1/target1:0:0/1:0:0:0/block/sdb"},
+		{"nvme0n1", "devices/pci0000:00/0000:00:1d.0/0000:3d:00.0/nvme/nvme0/nvme0n1"},
+		{"nvme0n1p2", "devices/pci0000:00/0000:00:1d.0/0000:3d:00.0/nvme/nvme0/nvme0n1/nvme0n1p2"},
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "sys", blk.dir), 0755))
+		symlink("../../"+blk.dir, "sys/class/block/"+blk.name)
+	}
+	mkfile("sys/class/block/sda1/partition", "1\n")
+	mkfile("sys/class/block/nvme0n1p2/partition", "2\n")
+
+	// Whole disks with their identity attributes, the SATA disks in an enclosure
+	symlink("../../sda", "dev/disk/by-id/ata-WDC_WD40EFRX-68N32N0_WD-WCC7K0000001")
+	symlink("../../sda", "dev/disk/by-id/wwn-0x50014ee2b0000001")
+	symlink("../../nvme0n1", "dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNX0T000001")
+	symlink("../../nvme0n1", "dev/disk/by-id/nvme-eui.002538b000000001")
+	for _, disk := range []struct{ name, device string }{
+		{"sda", "devices/pci0000:00/0000:00:17.0/ata1/host0/target0:0:0/0:0:0:0"},
+		{"sdb", "devices/pci0000:00/0000:00:17.0/ata2/host1/target1:0:0/1:0:0:0"},
+		{"nvme0n1", "devices/pci0000:00/0000:00:1d.0/0000:3d:00.0/nvme/nvme0"},
+	} {
+		dir, err := filepath.EvalSymlinks(filepath.Join(root, "sys/class/block", disk.name))
+		require.NoError(t, err)
+		symlink(dir, "sys/block/"+disk.name)
+		symlink(filepath.Join(root, "sys", disk.device), "sys/block/"+disk.name+"/device")
+	}
+	mkfile("sys/block/sda/size", "7814037168\n")
+	mkfile("sys/block/sda/queue/rotational", "1\n")
+	mkfile("sys/block/sda/device/model", "WDC WD40EFRX-68N\n")
+	mkfile("sys/block/sdb/size", "3907029168\n")
+	mkfile("sys/block/sdb/queue/rotational", "1\n")
+	mkfile("sys/block/sdb/device/wwid", "naa.5000c500a0000002\n")
+	mkfile("sys/block/nvme0n1/size", "1953525168\n")
+	mkfile("sys/block/nvme0n1/queue/rotational", "0\n")
+	mkfile("sys/block/nvme0n1/wwid", "eui.002538b000000001\n")
+	mkfile("sys/block/nvme0n1/device/model", "Samsung SSD 980 PRO 1TB                 \n")
+	mkfile("sys/block/nvme0n1/device/serial", "S5GXNX0T000001      \n")
+	symlink(filepath.Join(root, "sys/block/sda/device"), "sys/class/enclosure/0:0:8:0/Slot 01/device")
+	mkfile("sys/class/enclosure/0:0:8:0/Slot 01/slot", "1\n")
+	mkfile("sys/class/enclosure/0:0:8:0/Slot 01/locate", "0\n")
+	symlink(filepath.Join(root, "sys/block/sdb/device"), "sys/class/enclosure/0:0:8:0/Slot 02/device")
+	mkfile("sys/block/sda/device/power/runtime_status", "active\n")
+	mkfile("sys/block/sdb/device/power/runtime_status", "suspended\n")
+	return root
+}
+
+func TestBlockDevice(t *testing.T) {
+	r := Resolver{Root: makeSysfs(t)}
+	cases := map[string]string{
+		"/dev/sda1": "sda",
+		"/dev/sdb":  "sdb",
+		"/dev/disk/by-id/ata-WDC_WD40EFRX-68N32N0_WD-WCC7K0000001-part1":    "sda",
+		"/dev/disk/by-id/nvme-Samsung_SSD_980_PRO_1TB_S5GXNX0T000001-part2": "nvme0n1",
+	}
+	for path, want := range cases {
+		got, err := r.BlockDevice(path)
+		require.NoError(t, err, path)
+		assert.Equal(t, want, got, path)
+	}
+}
+
+func TestBlockDeviceMissing(t *testing.T) {
+	r := Resolver{Root: makeSysfs(t)}
+	_, err := r.BlockDevice("/dev/sdz1")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestDevPath(t *testing.T) {
+	assert.Equal(t, "/dev/nvme0n1", DevPath("nvme0n1"))
+}
+
+func TestIdentity(t *testing.T) {
+	r := Resolver{Root: makeSysfs(t)}
+
+	sda, err := r.Identity("sda")
+	require.NoError(t, err)
+	assert.Equal(t, Identity{
+		Model:      "WDC WD40EFRX-68N",
+		Serial:     "WD-WCC7K0000001",
+		WWN:        "0x50014ee2b0000001",
+		Size:       4000787030016,
+		Rotational: true,
+		Enclosure:  "0:0:8:0",
+		Slot:       "1",
+	}, sda)
+
+	// No by-id links: WWN from sysfs, slot from the component name
+	sdb, err := r.Identity("sdb")
+	require.NoError(t, err)
+	assert.Equal(t, "naa.5000c500a0000002", sdb.WWN)
+	assert.Empty(t, sdb.Serial)
+	assert.Equal(t, "Slot 02", sdb.Slot)
+
+	nvme, err := r.Identity("nvme0n1")
+	require.NoError(t, err)
+	assert.Equal(t, Identity{
+		Model:  "Samsung SSD 980 PRO 1TB",
+		Serial: "S5GXNX0T000001",
+		WWN:    "eui.002538b000000001",
+		Size:   1000204886016,
+	}, nvme)
+
+	_, err = r.Identity("sdz")
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestSuspended(t *testing.T) {
+	r := Resolver{Root: makeSysfs(t)}
+	assert.False(t, r.Suspended("sda"))
+	assert.True(t, r.Suspended("sdb"))
+	assert.False(t, r.Suspended("nvme0n1"), "Expected a disk without runtime PM to be active")
+}
+
+func TestLocate(t *testing.T) {
+	r := Resolver{Root: makeSysfs(t)}
+
+	on, err := r.Locate("sda")
+	require.NoError(t, err)
+	assert.False(t, on)
+	require.NoError(t, r.SetLocate("sda", true))
+	on, err = r.Locate("sda")
+	require.NoError(t, err)
+	assert.True(t, on)
+
+	_, err = r.Locate("sdb")
+	assert.ErrorIs(t, err, os.ErrNotExist, "Expected a slot without LED control to fail")
+	_, err = r.Locate("nvme0n1")
+	assert.ErrorIs(t, err, ErrNoSlot)
+	assert.ErrorIs(t, r.SetLocate("nvme0n1", true), ErrNoSlot)
+}
@@ -0,0 +1,172 @@
+package disk
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var Logger zerolog.Logger
+
+// Prefixes of whole block devices that are never pool disks: zvols, loop, device mapper and optical devices
+var virtualPrefixes = []string{"zd", "loop", "dm-", "sr"}
+
+// One udev event with the properties of its block device
+type monitorEvent struct {
+	action    string
+	name      string // kernel name, like "sdf"
+	devType   string // "disk" or "partition"
+	fsType    string // ID_FS_TYPE, like "zfs_member"
+	partTable string // ID_PART_TABLE_UUID
+}
+
+// poolDisk reports whether an event is about a whole disk that can be part of a pool.
+func (e monitorEvent) poolDisk() bool {
+	if e.devType != "disk" {
+		return false
+	}
+	for _, prefix := range virtualPrefixes {
+		if strings.HasPrefix(e.name, prefix) {
+			return false
+		}
+	}
+	return true
+}
+
+type monitorExecutor interface {
+	StdoutPipe() (io.ReadCloser, error)
+	Start() error
+	Wait() error
+}
+
+// Monitor follows udev block device events, to notice disks that are plugged in or removed.
+type Monitor struct {
+	retryDelay time.Duration
+	execFn     func(context.Context, string, ...string) monitorExecutor
+	labels     map[string]string // filesystem and partition table of each disk, from its last event
+}
+
+// NewMonitor returns a monitor that runs `udevadm monitor`.
+func NewMonitor() *Monitor {
+	return &Monitor{
+		retryDelay: time.Minute,
+		labels:     map[string]string{},
+		execFn: func(ctx context.Context, name string, arg ...string) monitorExecutor {
+			return exec.CommandContext(ctx, name, arg...)
+		},
+	}
+}
+
+// parseMonitor reads the output of `udevadm monitor --property` and calls fn for each event.
+// An event starts with a line like "UDEV  [1234.567890] add      /devices/.../block/sdf (block)",
+// followed by its properties like "DEVTYPE=disk" up to an empty line.
+func parseMonitor(r io.Reader, fn func(monitorEvent)) error {
+	var event *monitorEvent
+	flush := func() {
+		if event != nil {
+			fn(*event)
+			event = nil
+		}
+	}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			flush()
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && (fields[0] == "UDEV" || fields[0] == "KERNEL") && strings.HasPrefix(fields[1], "[") {
+			flush()
+			event = &monitorEvent{action: fields[2], name: filepath.Base(fields[3])}
+			continue
+		}
+		if event == nil {
+			continue
+		}
+		switch key, value, _ := strings.Cut(line, "="); key {
+		case "DEVNAME":
+			event.name = filepath.Base(value)
+		case "DEVTYPE":
+			event.devType = value
+		case "ID_FS_TYPE":
+			event.fsType = value
+		case "ID_PART_TABLE_UUID":
+			event.partTable = value
+		}
+	}
+	flush()
+	return scanner.Err()
+}
+
+// changesPool reports whether an event can change the disks of a pool: an added or removed disk,
+// or a change of its filesystem or partition table, like a new pool label.
+// Other change events are skipped, udev sends them after every close of a disk that was opened for writing, smartctl included.
+// The first change event of a disk that was present before the monitor started has nothing to compare to and is skipped too.
+func (m *Monitor) changesPool(e monitorEvent) bool {
+	if !e.poolDisk() {
+		return false
+	}
+	label := e.fsType + "/" + e.partTable
+	previous, seen := m.labels[e.name]
+	switch e.action {
+	case "add":
+		m.labels[e.name] = label
+		return true
+	case "remove":
+		delete(m.labels, e.name)
+		return true
+	case "change":
+		m.labels[e.name] = label
+		return seen && previous != label
+	}
+	return false
+}
+
+// follow runs `udevadm monitor` until it exits and sends the names of disks that were added, removed or relabeled.
+// Bursts of events are debounced by the receiver.
+func (m *Monitor) follow(ctx context.Context, out chan<- string) error {
+	// Events after rule processing, so the /dev/disk/by-id links are in place
+	cmd := m.execFn(ctx, "udevadm", "monitor", "--udev", "--property", "--subsystem-match=block/disk")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	parseErr := parseMonitor(stdout, func(event monitorEvent) {
+		if !m.changesPool(event) {
+			return
+		}
+		Logger.Debug().Str("mod", "disk").Str("action", event.action).Str("device", event.name).Msg("Block device event")
+		select {
+		case out <- event.name:
+		case <-ctx.Done():
+		}
+	})
+	return errors.Join(parseErr, cmd.Wait())
+}
+
+// Watch is a long-running routine that follows udev block device events and restarts the monitor if it exits.
+func (m *Monitor) Watch(ctx context.Context, out chan<- string) {
+	for {
+		err := m.follow(ctx, out)
+		if ctx.Err() != nil {
+			return
+		}
+		Logger.Error().Str("mod", "disk").Err(err).Msg("udevadm monitor exited")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(m.retryDelay):
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package disk
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mockMonitorCmd struct {
+	data []byte
+}
+
+func (m *mockMonitorCmd) StdoutPipe() (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(m.data))), nil
+}
+func (m *mockMonitorCmd) Start() error { return nil }
+func (m *mockMonitorCmd) Wait() error  { return nil }
+
+func TestParseMonitor(t *testing.T) {
+	file, err := os.Open("udevadm.txt")
+	require.NoError(t, err)
+	defer file.Close()
+	var events []string
+	require.NoError(t, parseMonitor(file, func(e monitorEvent) { events = append(events, e.action+" "+e.name+" "+e.devType) }))
+	assert.Equal(t, []string{
+		"add sdf disk", "add sdf1 partition", "change sdf disk", "add zd0 disk", "add loop0 disk",
+		"add dm-0 disk", "change sr0 disk", "remove sdb1 partition", "remove sdb disk", "change sdf disk", "change sda disk",
+	}, events)
+}
+
+func TestFollow(t *testing.T) {
+	data, err := os.ReadFile("udevadm.txt")
+	require.NoError(t, err)
+	monitor := NewMonitor()
+	monitor.execFn = func(_ context.Context, _ string, _ ...string) monitorExecutor { return &mockMonitorCmd{data: data} }
+
+	out := make(chan string, 10)
+	require.NoError(t, monitor.follow(context.Background(), out))
+	close(out)
+	var names []string
+	for name := range out {
+		names = append(names, name)
+	}
+	// sdf is repartitioned after it was added; sda was present before the monitor started
+	assert.Equal(t, []string{"sdf", "sdb", "sdf"}, names, "Expected partitions, virtual devices and change events without a new label to be skipped")
+}
@@ -10,3 +10,16 @@ import (
 type Provider interface {
 	Entries(context.Context) ([]models.Entry, error)
 }
+
+// Watcher is a provider that also follows a long-running source and sends entries as they happen.
+type Watcher interface {
+	Provider
+	Watch(context.Context, chan<- models.Entry)
+}
+
+// Commander is a provider whose entities accept commands from Home Assistant.
+// Command returns false if the topic does not belong to one of its entities.
+type Commander interface {
+	Provider
+	Command(ctx context.Context, topic string, payload []byte) (bool, error)
+}
@@ -0,0 +1,135 @@
+package sanoid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// A lock file that sanoid has held for longer than the freshness window
+type staleLock struct {
+	Name  string    `json:"name"`
+	Since time.Time `json:"since"`
+}
+
+// serviceProperty reads a property of a systemd service over D-Bus.
+func serviceProperty(ctx context.Context, unit, name string) (any, error) {
+	conn, err := dbus.NewWithContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	prop, err := conn.GetServicePropertyContext(ctx, unit, name)
+	if err != nil {
+		return nil, err
+	}
+	return prop.Value.Value(), nil
+}
+
+// unitExitTime returns when the main process of a systemd service last exited, or false if it never ran.
+// This is the last run of the sanoid timer. The snapshot cache is no signal, as the --monitor-* runs of the sanoid provider rewrite it too.
+// Systemd reports a zero timestamp for services that never ran and for unknown services.
+func unitExitTime(ctx context.Context, property func(context.Context, string, string) (any, error), unit string) (time.Time, bool, error) {
+	value, err := property(ctx, unit, "ExecMainExitTimestamp")
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	usec, ok := value.(uint64)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("%s ExecMainExitTimestamp: unexpected value %v", unit, value)
+	}
+	if usec == 0 {
+		return time.Time{}, false, nil
+	}
+	return time.UnixMicro(int64(usec)), true, nil
+}
+
+// findStaleLocks lists the lock files older than the cutoff. A missing lock directory means no locks are held.
+func findStaleLocks(dir string, cutoff time.Time) ([]staleLock, error) {
+	dirEntries, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return []staleLock{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	locks := []staleLock{}
+	for _, entry := range dirEntries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".lock" {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().Before(cutoff) {
+			locks = append(locks, staleLock{Name: entry.Name(), Since: info.ModTime().UTC()})
+		}
+	}
+	return locks, nil
+}
+
+// NewFreshnessProvider returns a provider that publishes when sanoid last ran and whether it has stalled.
+// The last run is the last exit of the sanoid service, started by its timer; the locks are read from the lock directory.
+func NewFreshnessProvider(config models.Sanoid, device models.Device, interval time.Duration) *FreshnessProvider {
+	host := mqttclient.NormalizeStr(device.Name)
+	lastUID := host + "_sanoid_last_run"
+	stalledUID := host + "_sanoid_stalled"
+	expire := int((interval * 2).Seconds())
+	return &FreshnessProvider{
+		config:  config,
+		lastRun: models.MqttConfig{Name: "Sanoid last ran", StateTopic: "homeassistant/sensor/" + lastUID + "/state", DeviceClass: "timestamp", UniqueID: lastUID, Device: device, ExpireAfter: expire, ForceUpdate: true},
+		stalled: models.MqttConfig{Name: "Sanoid stalled", StateTopic: "homeassistant/binary_sensor/" + stalledUID + "/state", JsonAttributesTopic: "homeassistant/binary_sensor/" + stalledUID + "/attributes", DeviceClass: "problem", UniqueID: stalledUID, Device: device, ExpireAfter: expire, ForceUpdate: true},
+		now:     time.Now,
+		exitTime: func(ctx context.Context, unit string) (time.Time, bool, error) {
+			return unitExitTime(ctx, serviceProperty, unit)
+		},
+	}
+}
+
+// Entries returns the last run timestamp sensor and the stalled problem sensor.
+// Sanoid has stalled if its service never ran or last exited before the configured window, or if it holds a lock for longer than that.
+func (p *FreshnessProvider) Entries(ctx context.Context) ([]models.Entry, error) {
+	window := time.Duration(p.config.MaxAgeMinutes) * time.Minute
+	cutoff := p.now().Add(-window)
+	last, found, err := p.exitTime(ctx, p.config.Unit)
+	if err != nil {
+		return nil, err
+	}
+	locks, err := findStaleLocks(p.config.LockDir, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	stalled := !found || last.Before(cutoff) || len(locks) > 0
+	if stalled {
+		Logger.Warn().Str("mod", "sanoid").Time("last_run", last).Int("stale_locks", len(locks)).Msg("Sanoid has stalled")
+	}
+
+	lastPayload := []byte("None")
+	attrs := map[string]any{
+		"max_age_minutes": p.config.MaxAgeMinutes,
+		"stale_locks":     locks,
+		"last_run":        nil,
+	}
+	if found {
+		lastPayload = []byte(last.UTC().Format(time.RFC3339))
+		attrs["last_run"] = last.UTC().Format(time.RFC3339)
+	}
+	attrsJSON, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+	return []models.Entry{
+		{Config: p.lastRun, Domain: "sensor", Payload: lastPayload},
+		{Config: p.stalled, Domain: "binary_sensor", Payload: mqttclient.ProblemPayload(!stalled), Attributes: attrsJSON},
+	}, nil
+}
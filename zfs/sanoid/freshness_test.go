@@ -0,0 +1,102 @@
+package sanoid
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func TestFreshnessEntries(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	config := models.ZFSdefault().Sanoid
+	config.LockDir = filepath.Join(dir, "run")
+	provider := NewFreshnessProvider(config, models.Device{Name: "host"}, time.Minute)
+	provider.now = func() time.Time { return now }
+	var exited time.Time
+	provider.exitTime = func(_ context.Context, unit string) (time.Time, bool, error) {
+		assert.Equal(t, "sanoid.service", unit)
+		return exited, !exited.IsZero(), nil
+	}
+	entries := func() (models.Entry, models.Entry, map[string]any) {
+		entries, err := provider.Entries(context.Background())
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		var attrs map[string]any
+		require.NoError(t, json.Unmarshal(entries[1].Attributes, &attrs))
+		return entries[0], entries[1], attrs
+	}
+
+	// Never ran: unknown last run and stalled
+	last, stalled, _ := entries()
+	assert.Equal(t, "host_sanoid_last_run", last.Config.UniqueID)
+	assert.Equal(t, []byte("None"), last.Payload)
+	assert.Equal(t, []byte("ON"), stalled.Payload)
+
+	exited = now.Add(-20 * time.Minute)
+	last, stalled, attrs := entries()
+	assert.Equal(t, []byte("2026-10-18T11:40:00Z"), last.Payload)
+	assert.Equal(t, []byte("OFF"), stalled.Payload)
+	assert.Empty(t, attrs["stale_locks"])
+
+	// A lock held for longer than the window
+	require.NoError(t, os.Mkdir(config.LockDir, 0755))
+	for name, age := range map[string]time.Duration{"sanoid_pruning.lock": 3 * time.Hour, "sanoid_cacheupdate.lock": time.Minute, "notes.txt": 3 * time.Hour} {
+		path := filepath.Join(config.LockDir, name)
+		require.NoError(t, os.WriteFile(path, nil, 0644))
+		require.NoError(t, os.Chtimes(path, now, now.Add(-age)))
+	}
+	_, stalled, attrs = entries()
+	assert.Equal(t, []byte("ON"), stalled.Payload)
+	assert.Equal(t, []any{map[string]any{"name": "sanoid_pruning.lock", "since": "2026-10-18T09:00:00Z"}}, attrs["stale_locks"])
+
+	// Last run before the window
+	require.NoError(t, os.Remove(filepath.Join(config.LockDir, "sanoid_pruning.lock")))
+	exited = now.Add(-2 * time.Hour)
+	_, stalled, attrs = entries()
+	assert.Equal(t, []byte("ON"), stalled.Payload)
+	assert.Equal(t, "2026-10-18T10:00:00Z", attrs["last_run"])
+}
+
+func TestUnitExitTime(t *testing.T) {
+	property := func(value any, err error) func(context.Context, string, string) (any, error) {
+		return func(_ context.Context, unit, name string) (any, error) {
+			assert.Equal(t, "sanoid.service", unit)
+			assert.Equal(t, "ExecMainExitTimestamp", name)
+			return value, err
+		}
+	}
+	exited := time.Date(2026, 10, 18, 11, 45, 0, 0, time.UTC)
+	last, found, err := unitExitTime(context.Background(), property(uint64(exited.UnixMicro()), nil), "sanoid.service")
+	require.NoError(t, err)
+	assert.True(t, found)
+	assert.True(t, exited.Equal(last))
+
+	// A service that never ran, or that does not exist
+	_, found, err = unitExitTime(context.Background(), property(uint64(0), nil), "sanoid.service")
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	_, _, err = unitExitTime(context.Background(), property(nil, nil), "sanoid.service")
+	assert.ErrorContains(t, err, "unexpected value")
+
+	busErr := errors.New("dial unix /run/dbus/system_bus_socket: connect: no such file or directory")
+	_, _, err = unitExitTime(context.Background(), property(nil, busErr), "sanoid.service")
+	assert.ErrorIs(t, err, busErr)
+
+	// The provider fails on D-Bus errors instead of reporting a stall
+	provider := NewFreshnessProvider(models.ZFSdefault().Sanoid, models.Device{Name: "host"}, time.Minute)
+	provider.exitTime = func(ctx context.Context, unit string) (time.Time, bool, error) {
+		return unitExitTime(ctx, property(nil, busErr), unit)
+	}
+	_, err = provider.Entries(context.Background())
+	assert.ErrorIs(t, err, busErr)
+}
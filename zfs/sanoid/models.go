@@ -2,6 +2,7 @@ package sanoid
 
 import (
 	"context"
+	"time"
 
 	"github.com/ykgmfq/SystemPub/models"
 )
@@ -10,8 +11,27 @@ type commandExecutor interface {
 	Output() ([]byte, error)
 }
 
+// FreshnessProvider checks that sanoid runs regularly, from the last exit of its service and the age of its lock files.
+type FreshnessProvider struct {
+	config   models.Sanoid
+	lastRun  models.MqttConfig
+	stalled  models.MqttConfig
+	now      func() time.Time
+	exitTime func(context.Context, string) (time.Time, bool, error)
+}
+
+// RetentionProvider compares the number of sanoid snapshots per dataset with the retention policy.
+type RetentionProvider struct {
+	config    models.Sanoid
+	backlog   models.MqttConfig
+	shellExec func(context.Context, string, ...string) commandExecutor
+}
+
 // SanoidProvider checks pool health, capacity and snapshots via the sanoid CLI.
 type SanoidProvider struct {
+	path      string
+	timeout   time.Duration
 	configs   map[models.Property]models.MqttConfig
+	severity  map[models.Property]models.MqttConfig
 	shellExec func(context.Context, string, ...string) commandExecutor
 }
@@ -0,0 +1,285 @@
+package sanoid
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// Snapshot periods of a sanoid template, each with the number of snapshots to keep
+var retentionPeriods = []string{"frequently", "hourly", "daily", "weekly", "monthly", "yearly"}
+
+// Retention of sanoid's built-in template_default, from sanoid.defaults.conf
+var defaultRetention = map[string]string{
+	"frequently": "0",
+	"hourly":     "48",
+	"daily":      "90",
+	"weekly":     "0",
+	"monthly":    "6",
+	"yearly":     "0",
+	"autoprune":  "yes",
+}
+
+// Retention policy of a dataset section in sanoid.conf
+type retentionPolicy struct {
+	expected     int
+	pruned       bool // false with autoprune disabled, the snapshot count is then not checked
+	recursive    bool
+	childrenOnly bool
+}
+
+// Snapshots of one dataset, with the space only they hold
+type snapshotStats struct {
+	Dataset         string `json:"dataset"`
+	Snapshots       int    `json:"snapshots"`
+	Expected        int    `json:"expected"`
+	UsedBySnapshots int64  `json:"used_by_snapshots"`
+	Oldest          string `json:"oldest,omitempty"`
+}
+
+// parseSanoidConf reads the sections of sanoid.conf, an INI file like "[tank/data]" followed by "use_template = production".
+func parseSanoidConf(r io.Reader) (map[string]map[string]string, error) {
+	sections := map[string]map[string]string{}
+	var current map[string]string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			name := strings.TrimSpace(line[1 : len(line)-1])
+			if sections[name] == nil {
+				sections[name] = map[string]string{}
+			}
+			current = sections[name]
+		case current != nil:
+			key, value, ok := strings.Cut(line, "=")
+			if ok {
+				current[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+			}
+		}
+	}
+	return sections, scanner.Err()
+}
+
+// isYes reads a sanoid boolean. Recursive may also be "zfs", which counts as yes.
+func isYes(value string) bool {
+	switch strings.ToLower(value) {
+	case "yes", "1", "zfs":
+		return true
+	}
+	return false
+}
+
+// retentionPolicies resolves the templates of every dataset section.
+// Values are taken from the built-in defaults, template_default, the templates in use_template order and the section itself, the last one winning.
+// Datasets with autoprune disabled are kept as unpruned policies, so they do not inherit the policy of a recursive parent.
+func retentionPolicies(sections map[string]map[string]string) map[string]retentionPolicy {
+	policies := map[string]retentionPolicy{}
+	for name, section := range sections {
+		if strings.HasPrefix(name, "template_") {
+			continue
+		}
+		values := map[string]string{}
+		layers := []map[string]string{defaultRetention, sections["template_default"]}
+		for _, template := range strings.Split(section["use_template"], ",") {
+			if template = strings.TrimSpace(template); template != "" {
+				layers = append(layers, sections["template_"+template])
+			}
+		}
+		for _, layer := range append(layers, section) {
+			for key, value := range layer {
+				values[key] = value
+			}
+		}
+		expected := 0
+		for _, period := range retentionPeriods {
+			n, err := strconv.Atoi(values[period])
+			if err == nil {
+				expected += n
+			}
+		}
+		policies[name] = retentionPolicy{
+			expected:     expected,
+			pruned:       isYes(values["autoprune"]),
+			recursive:    isYes(values["recursive"]),
+			childrenOnly: isYes(values["process_children_only"]),
+		}
+	}
+	return policies
+}
+
+// expectedSnapshots returns the expected snapshot count of a dataset, from its own section or the closest recursive parent.
+// Like sanoid, non-recursive parents are skipped. False if the policy does not prune or leaves out the dataset.
+func expectedSnapshots(policies map[string]retentionPolicy, dataset string) (int, bool) {
+	policy, ok := policies[dataset]
+	if ok && policy.childrenOnly {
+		return 0, false
+	}
+	for parent := path.Dir(dataset); !ok && parent != "." && parent != "/"; parent = path.Dir(parent) {
+		policy, ok = policies[parent]
+		ok = ok && policy.recursive
+	}
+	if !ok || !policy.pruned {
+		return 0, false
+	}
+	return policy.expected, true
+}
+
+// readPolicies reads the retention policies from sanoid.conf. A missing file means no policies.
+func readPolicies(confPath string) (map[string]retentionPolicy, error) {
+	f, err := os.Open(confPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]retentionPolicy{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	sections, err := parseSanoidConf(f)
+	if err != nil {
+		return nil, err
+	}
+	return retentionPolicies(sections), nil
+}
+
+// runZfsList runs `zfs list -H -p` and returns the tab separated columns of each line.
+func runZfsList(ctx context.Context, run func(context.Context, string, ...string) commandExecutor, timeout time.Duration, arg ...string) ([][]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	out, err := run(ctx, "zfs", append([]string{"list", "-H", "-p"}, arg...)...).Output()
+	if err != nil {
+		return nil, err
+	}
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		if line != "" {
+			rows = append(rows, strings.Split(line, "\t"))
+		}
+	}
+	return rows, nil
+}
+
+// collectSnapshots counts the sanoid snapshots of every dataset, and finds the oldest one.
+// Snapshots of other tools are not managed by the sanoid retention and are not counted.
+func collectSnapshots(rows [][]string) map[string]*snapshotStats {
+	stats := map[string]*snapshotStats{}
+	oldest := map[string]int64{}
+	for _, row := range rows {
+		if len(row) < 2 {
+			continue
+		}
+		dataset, snapshot, ok := strings.Cut(row[0], "@")
+		if !ok || !strings.HasPrefix(snapshot, "autosnap_") {
+			continue
+		}
+		s := stats[dataset]
+		if s == nil {
+			s = &snapshotStats{Dataset: dataset}
+			stats[dataset] = s
+		}
+		s.Snapshots++
+		creation, err := strconv.ParseInt(row[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		if first, seen := oldest[dataset]; !seen || creation < first {
+			oldest[dataset] = creation
+			s.Oldest = time.Unix(creation, 0).UTC().Format(time.RFC3339)
+		}
+	}
+	return stats
+}
+
+// NewRetentionProvider returns a provider that detects snapshot backlogs, when sanoid stops pruning.
+func NewRetentionProvider(config models.Sanoid, device models.Device, interval time.Duration) *RetentionProvider {
+	uid := mqttclient.NormalizeStr(device.Name) + "_snapshot_backlog"
+	return &RetentionProvider{
+		config:  config,
+		backlog: models.MqttConfig{Name: "Snapshot backlog", StateTopic: "homeassistant/binary_sensor/" + uid + "/state", JsonAttributesTopic: "homeassistant/binary_sensor/" + uid + "/attributes", DeviceClass: "problem", UniqueID: uid, Device: device, ExpireAfter: int((interval * 2).Seconds()), ForceUpdate: true},
+		shellExec: func(ctx context.Context, name string, arg ...string) commandExecutor {
+			return exec.CommandContext(ctx, name, arg...)
+		},
+	}
+}
+
+// Entries returns the snapshot backlog problem sensor.
+// It is on if a dataset holds more sanoid snapshots than the backlog factor times its expected retention.
+// The attributes list these datasets with their snapshot count, the space held only by snapshots and the oldest snapshot.
+func (p *RetentionProvider) Entries(ctx context.Context) ([]models.Entry, error) {
+	policies, err := readPolicies(p.config.ConfPath)
+	if err != nil {
+		return nil, err
+	}
+	timeout := time.Duration(p.config.TimeoutSeconds) * time.Second
+	snapshots, err := runZfsList(ctx, p.shellExec, timeout, "-t", "snapshot", "-o", "name,creation")
+	if err != nil {
+		return nil, fmt.Errorf("zfs list snapshots: %w", err)
+	}
+	datasets, err := runZfsList(ctx, p.shellExec, timeout, "-t", "filesystem,volume", "-o", "name,usedbysnapshots")
+	if err != nil {
+		return nil, fmt.Errorf("zfs list datasets: %w", err)
+	}
+	stats := collectSnapshots(snapshots)
+
+	backlog := []snapshotStats{}
+	checked := 0
+	for _, row := range datasets {
+		if len(row) < 2 {
+			continue
+		}
+		expected, ok := p.config.Retention[row[0]]
+		if !ok {
+			expected, ok = expectedSnapshots(policies, row[0])
+		}
+		if !ok {
+			continue
+		}
+		checked++
+		s := stats[row[0]]
+		if s == nil || float64(s.Snapshots) <= p.config.BacklogFactor*float64(expected) {
+			continue
+		}
+		s.Expected = expected
+		s.UsedBySnapshots, _ = strconv.ParseInt(row[1], 10, 64)
+		backlog = append(backlog, *s)
+	}
+	slices.SortFunc(backlog, func(a, b snapshotStats) int { return strings.Compare(a.Dataset, b.Dataset) })
+	if len(backlog) > 0 {
+		Logger.Warn().Str("mod", "sanoid").Int("datasets", len(backlog)).Msg("Snapshot backlog")
+	}
+
+	attrs, err := json.Marshal(map[string]any{
+		"checked":        checked,
+		"backlog_factor": p.config.BacklogFactor,
+		"datasets":       backlog,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return []models.Entry{{
+		Config:     p.backlog,
+		Domain:     "binary_sensor",
+		Payload:    mqttclient.BinaryPayload(len(backlog) > 0),
+		Attributes: attrs,
+	}}, nil
+}
@@ -0,0 +1,100 @@
+package sanoid
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func TestRetentionPolicies(t *testing.T) {
+	f, err := os.Open("sanoid.conf")
+	require.NoError(t, err)
+	defer f.Close()
+	sections, err := parseSanoidConf(f)
+	require.NoError(t, err)
+	policies := retentionPolicies(sections)
+
+	cases := map[string]struct {
+		expected int
+		ok       bool
+	}{
+		"tank/data":        {69, true},
+		"tank/data/photos": {69, true},
+		"tank/home":        {33, true},
+		"tank/home/alice":  {14, true}, // tank/home is not recursive, the recursive tank applies
+		"tank/vms":         {0, false},
+		"tank/vms/win11":   {69, true},
+		"tank/scratch":     {0, false}, // Not pruned, the recursive tank does not apply
+		"tank/scratch/tmp": {14, true},
+		"tank":             {14, true},
+		"tank/media":       {14, true},
+		"pool/data":        {0, false},
+	}
+	for dataset, want := range cases {
+		expected, ok := expectedSnapshots(policies, dataset)
+		assert.Equal(t, want.ok, ok, dataset)
+		assert.Equal(t, want.expected, expected, dataset)
+	}
+}
+
+// snapshotListing builds `zfs list -t snapshot` output with count hourly sanoid snapshots, an hour apart, and one manual snapshot.
+func snapshotListing(dataset string, count int, first time.Time) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s@manual\t%d\n", dataset, first.Add(-time.Hour).Unix())
+	for i := range count {
+		created := first.Add(time.Duration(i) * time.Hour)
+		fmt.Fprintf(&b, "%s@autosnap_%s_hourly\t%d\n", dataset, created.Format("2006-01-02_15:04:05"), created.Unix())
+	}
+	return b.String()
+}
+
+func TestRetentionEntries(t *testing.T) {
+	first := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	snapshots := snapshotListing("tank/data", 60, first) + snapshotListing("tank/home", 200, first) + snapshotListing("tank/vms/win11", 500, first) + snapshotListing("tank/scratch", 900, first)
+	datasets := "tank\t0\ntank/data\t1073741824\ntank/home\t5368709120\ntank/vms\t0\ntank/vms/win11\t21474836480\ntank/scratch\t0\n"
+
+	config := models.ZFSdefault().Sanoid
+	config.ConfPath = "sanoid.conf"
+	config.Retention = map[string]int{"tank/vms/win11": 300}
+	provider := NewRetentionProvider(config, models.Device{Name: "host"}, time.Minute)
+	provider.shellExec = func(_ context.Context, name string, arg ...string) commandExecutor {
+		assert.Equal(t, "zfs", name)
+		if strings.Join(arg[3:5], " ") == "-t snapshot" {
+			return &MockCommandExecutor{output: []byte(snapshots)}
+		}
+		return &MockCommandExecutor{output: []byte(datasets)}
+	}
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "host_snapshot_backlog", entries[0].Config.UniqueID)
+	assert.Equal(t, []byte("ON"), entries[0].Payload)
+	var attrs struct {
+		Checked  int             `json:"checked"`
+		Datasets []snapshotStats `json:"datasets"`
+	}
+	require.NoError(t, json.Unmarshal(entries[0].Attributes, &attrs))
+	assert.Equal(t, 4, attrs.Checked)
+	// tank/data is within its retention, tank/vms/win11 within the configured override and tank/scratch is not pruned by sanoid
+	assert.Equal(t, []snapshotStats{{
+		Dataset:         "tank/home",
+		Snapshots:       200,
+		Expected:        33,
+		UsedBySnapshots: 5368709120,
+		Oldest:          "2026-09-01T00:00:00Z",
+	}}, attrs.Datasets)
+
+	provider.shellExec = func(_ context.Context, _ string, _ ...string) commandExecutor {
+		return &MockCommandExecutor{err: os.ErrPermission}
+	}
+	_, err = provider.Entries(context.Background())
+	assert.ErrorIs(t, err, os.ErrPermission)
+}
@@ -5,8 +5,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os/exec"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
@@ -16,31 +21,93 @@ import (
 
 var Logger zerolog.Logger
 
+// Severity states of a sanoid monitor, as options of its enum sensor
+var sanoidStates = []string{"Ok", "Warning", "Critical", "Error", "UNKNOWN", "Timeout"}
+
+// Time to wait for the output pipes after sanoid was killed, which its zfs children may still hold open
+const monitorWaitDelay = 2 * time.Second
+
+// errTimeout marks a monitor that sanoid did not finish within the configured timeout
+var errTimeout = errors.New("timed out")
+
+// Start of a message in the monitor output, like "CRIT: tank/data newest hourly snapshot is 2d old"
+var messageStart = regexp.MustCompile(`(?:^|[,;\n]\s*)(CRITICAL|CRIT|WARNING|WARN|UNKNOWN|OK)\b`)
+
 // Maps Sanoid exit codes to human-readable states.
 func sanoidState(exit int) string {
-	if exit > 4 || exit < 0 {
+	if exit > 3 || exit < 0 {
 		return "UNKNOWN"
 	}
-	var sanoidExitLevels = map[int]string{
-		0: "Ok",
-		1: "Warning",
-		2: "Critical",
-		3: "Error",
+	return sanoidStates[exit]
+}
+
+// Messages of a sanoid monitor, with the datasets by severity
+type monitorReport struct {
+	Crit     []string `json:"crit"`
+	Warn     []string `json:"warn"`
+	Messages []string `json:"messages"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// parseMonitorOutput splits the output of a sanoid monitor into messages and collects the datasets or pools that are WARN or CRIT.
+// The dataset is the first word after the severity, skipping the "ZPOOL" of the health check.
+func parseMonitorOutput(output string) monitorReport {
+	report := monitorReport{Crit: []string{}, Warn: []string{}, Messages: []string{}}
+	matches := messageStart.FindAllStringSubmatchIndex(output, -1)
+	for i, m := range matches {
+		end := len(output)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		msg := strings.TrimSpace(output[m[2]:end])
+		report.Messages = append(report.Messages, msg)
+		var list *[]string
+		switch output[m[2]:m[3]] {
+		case "CRITICAL", "CRIT":
+			list = &report.Crit
+		case "WARNING", "WARN":
+			list = &report.Warn
+		default:
+			continue
+		}
+		for _, word := range strings.Fields(output[m[3]:end]) {
+			word = strings.Trim(word, ":")
+			if word != "" && word != "ZPOOL" {
+				if !slices.Contains(*list, word) {
+					*list = append(*list, word)
+				}
+				break
+			}
+		}
 	}
-	return sanoidExitLevels[exit]
+	return report
+}
+
+// monitorCommand returns a command that runs in its own process group.
+// On cancellation the whole group is killed, so zfs children that sanoid started do not keep the output pipe open.
+func monitorCommand(ctx context.Context, name string, arg ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, arg...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error { return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL) }
+	cmd.WaitDelay = monitorWaitDelay
+	return cmd
 }
 
 // Runs Sanoid to check one of pool health, capacity and snapshots.
 // Returns (ok, state, output, err): state is non-empty when exit code 1-4 (pool problem, sanoid healthy).
-func getPoolState(ctx context.Context, run func(context.Context, string, ...string) commandExecutor, p models.Property) (bool, string, string, error) {
-	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+// err wraps errTimeout if sanoid did not finish in time.
+func getPoolState(ctx context.Context, run func(context.Context, string, ...string) commandExecutor, path string, timeout time.Duration, p models.Property) (bool, string, string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
-	cmd := run(ctx, "sanoid", "--monitor-"+models.PropStr[p])
+	cmd := run(ctx, path, "--monitor-"+models.PropStr[p])
 	raw, err := cmd.Output()
 	output := strings.TrimSpace(string(raw))
 	if err == nil {
 		return true, "", output, nil
 	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return false, "", output, fmt.Errorf("sanoid --monitor-%s %w after %s", models.PropStr[p], errTimeout, timeout)
+	}
 	var exitError *exec.ExitError
 	if !errors.As(err, &exitError) {
 		return false, "", output, err
@@ -65,33 +132,90 @@ func GetPoolConfigs(device models.Device, interval time.Duration) map[models.Pro
 	return configs
 }
 
+// getSeverityConfigs gathers autodiscovery configs for the health, capacity and snapshot severity enum sensors.
+func getSeverityConfigs(device models.Device, interval time.Duration) map[models.Property]models.MqttConfig {
+	configs := make(map[models.Property]models.MqttConfig, len(models.PropStr))
+	unique_id_pre := mqttclient.NormalizeStr(device.Name) + "_sanoid_"
+	for prop, propStr := range models.PropStr {
+		unique_id := unique_id_pre + propStr
+		topic := "homeassistant/sensor/" + unique_id + "/state"
+		attrTopic := "homeassistant/sensor/" + unique_id + "/attributes"
+		configs[prop] = models.MqttConfig{Name: "Sanoid " + propStr, StateTopic: topic, JsonAttributesTopic: attrTopic, DeviceClass: "enum", Options: sanoidStates, UniqueID: unique_id, Device: device, ExpireAfter: int((interval * 2).Seconds()), ForceUpdate: true}
+	}
+	return configs
+}
+
 // NewSanoidProvider returns a provider that runs sanoid to check pool state.
-func NewSanoidProvider(device models.Device, interval time.Duration) *SanoidProvider {
+func NewSanoidProvider(config models.Sanoid, device models.Device, interval time.Duration) *SanoidProvider {
 	return &SanoidProvider{
+		path:      config.Path,
+		timeout:   time.Duration(config.TimeoutSeconds) * time.Second,
 		configs:   GetPoolConfigs(device, interval),
-		shellExec: func(ctx context.Context, name string, arg ...string) commandExecutor { return exec.CommandContext(ctx, name, arg...) },
+		severity:  getSeverityConfigs(device, interval),
+		shellExec: func(ctx context.Context, name string, arg ...string) commandExecutor { return monitorCommand(ctx, name, arg...) },
 	}
 }
 
-// Entries runs sanoid for each monitored property and returns the current sensor states.
+// Result of one sanoid monitor run
+type monitorResult struct {
+	ok     bool
+	state  string
+	output string
+	err    error
+}
+
+// Entries runs the sanoid monitors concurrently and returns the current problem and severity sensor states.
+// The attributes list the datasets with warnings and critical findings, parsed from the monitor output.
+// A monitor that times out or fails is published with the Timeout or Error state and an unknown problem flag, without affecting the others.
 func (p *SanoidProvider) Entries(ctx context.Context) ([]models.Entry, error) {
-	entries := make([]models.Entry, 0, len(p.configs))
+	results := make(map[models.Property]*monitorResult, len(p.configs))
+	var wg sync.WaitGroup
+	for property := range p.configs {
+		result := &monitorResult{}
+		results[property] = result
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result.ok, result.state, result.output, result.err = getPoolState(ctx, p.shellExec, p.path, p.timeout, property)
+		}()
+	}
+	wg.Wait()
+
+	entries := make([]models.Entry, 0, 2*len(p.configs))
 	for property, config := range p.configs {
-		ok, state, output, err := getPoolState(ctx, p.shellExec, property)
-		if err != nil {
-			return nil, err
-		}
-		if !ok && state != "" {
+		result := results[property]
+		report := parseMonitorOutput(result.output)
+		problem := mqttclient.ProblemPayload(result.ok)
+		state := result.state
+		switch {
+		case errors.Is(result.err, errTimeout):
+			Logger.Warn().Str("mod", "sanoid").Err(result.err).Msg("")
+			report.Error = result.err.Error()
+			problem = []byte("None")
+			state = "Timeout"
+		case result.err != nil:
+			Logger.Error().Str("mod", "sanoid").Str("monitor", models.PropStr[property]).Err(result.err).Msg("")
+			report.Error = result.err.Error()
+			problem = []byte("None")
+			state = "Error"
+		case result.ok:
+			state = sanoidState(0)
+		case state != "":
 			Logger.Warn().Str("mod", "sanoid").Str("state", state).Msg("")
 		}
-		attrs, err := json.Marshal(map[string]string{"output": output})
+		attrs, err := json.Marshal(report)
 		if err != nil {
 			return nil, err
 		}
 		entries = append(entries, models.Entry{
 			Config:     config,
 			Domain:     "binary_sensor",
-			Payload:    mqttclient.ProblemPayload(ok),
+			Payload:    problem,
+			Attributes: attrs,
+		}, models.Entry{
+			Config:     p.severity[property],
+			Domain:     "sensor",
+			Payload:    []byte(state),
 			Attributes: attrs,
 		})
 	}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -41,9 +42,18 @@ func (m *MockCommandExecutor) Output() ([]byte, error) {
 	return m.output, m.err
 }
 
+// entriesByUID maps the entries to their unique ID.
+func entriesByUID(entries []models.Entry) map[string]models.Entry {
+	byUID := make(map[string]models.Entry, len(entries))
+	for _, e := range entries {
+		byUID[e.Config.UniqueID] = e
+	}
+	return byUID
+}
+
 func TestGetPoolStateOK(t *testing.T) {
 	mockRun := func(_ context.Context, _ string, _ ...string) commandExecutor { return &MockCommandExecutor{} }
-	result, _, _, err := getPoolState(context.Background(), mockRun, models.Health)
+	result, _, _, err := getPoolState(context.Background(), mockRun, "sanoid", time.Second, models.Health)
 	assert.NoError(t, err, "Expected no error on clean exit")
 	assert.True(t, result, "Expected pool state to be true on clean exit")
 }
@@ -53,7 +63,7 @@ func TestGetPoolStatePoolProblem(t *testing.T) {
 		sanoidErr := makeExitError(exitcode)
 		assert.NotNil(t, sanoidErr, "Failed to create exit error for code %d", exitcode)
 		mockRun := func(_ context.Context, _ string, _ ...string) commandExecutor { return &MockCommandExecutor{err: sanoidErr} }
-		result, _, _, err := getPoolState(context.Background(), mockRun, models.Health)
+		result, _, _, err := getPoolState(context.Background(), mockRun, "sanoid", time.Second, models.Health)
 		assert.NoError(t, err, "Expected no error on exit codes 1-4")
 		assert.False(t, result, "Expected pool state to be false on exit codes 1-4")
 	}
@@ -62,7 +72,7 @@ func TestGetPoolStatePoolProblem(t *testing.T) {
 func TestGetPoolStateSanoidProblem(t *testing.T) {
 	for _, testerr := range []error{makeExitError(255), makeExitError(5), exec.ErrNotFound} {
 		mockRun := func(_ context.Context, _ string, _ ...string) commandExecutor { return &MockCommandExecutor{err: testerr} }
-		result, _, _, err := getPoolState(context.Background(), mockRun, models.Health)
+		result, _, _, err := getPoolState(context.Background(), mockRun, "sanoid", time.Second, models.Health)
 		assert.Equal(t, testerr, err, "Expected error to be escalated")
 		assert.False(t, result, "Expected pool state to be false on sanoid problem")
 	}
@@ -72,7 +82,118 @@ func TestGetPoolStateKilled(t *testing.T) {
 	killedErr := makeKilledError(t)
 	assert.Equal(t, -1, killedErr.ExitCode())
 	mockRun := func(_ context.Context, _ string, _ ...string) commandExecutor { return &MockCommandExecutor{err: killedErr} }
-	result, _, _, err := getPoolState(context.Background(), mockRun, models.Health)
+	result, _, _, err := getPoolState(context.Background(), mockRun, "sanoid", time.Second, models.Health)
 	assert.Equal(t, killedErr, err, "Expected killed-process error to be escalated")
 	assert.False(t, result)
 }
+
+func TestParseMonitorOutput(t *testing.T) {
+	snapshots := "CRIT: tank/data has no daily snapshots at all!, WARN: tank/home newest hourly snapshot is 2h 1m old (should be < 1h 30m 0s), CRIT: tank/data newest hourly snapshot is 3d 2h old (should be < 6h 0m 0s)"
+	report := parseMonitorOutput(snapshots)
+	assert.Equal(t, []string{"tank/data"}, report.Crit)
+	assert.Equal(t, []string{"tank/home"}, report.Warn)
+	assert.Equal(t, []string{
+		"CRIT: tank/data has no daily snapshots at all!",
+		"WARN: tank/home newest hourly snapshot is 2h 1m old (should be < 1h 30m 0s)",
+		"CRIT: tank/data newest hourly snapshot is 3d 2h old (should be < 6h 0m 0s)",
+	}, report.Messages)
+
+	report = parseMonitorOutput("WARNING ZPOOL tank : DEGRADED {Size:3.62T Free:1.20T Cap:66%}; OK ZPOOL rpool : ONLINE")
+	assert.Equal(t, []string{"tank"}, report.Warn)
+	assert.Empty(t, report.Crit)
+	assert.Len(t, report.Messages, 2)
+
+	report = parseMonitorOutput("OK: all monitored datasets (tank/data, tank/home) have fresh snapshots")
+	assert.Empty(t, report.Crit)
+	assert.Empty(t, report.Warn)
+	assert.Equal(t, []string{"OK: all monitored datasets (tank/data, tank/home) have fresh snapshots"}, report.Messages)
+}
+
+func TestEntriesSeverity(t *testing.T) {
+	provider := NewSanoidProvider(models.ZFSdefault().Sanoid, models.Device{Name: "host"}, time.Minute)
+	provider.shellExec = func(_ context.Context, _ string, arg ...string) commandExecutor {
+		if arg[0] == "--monitor-snapshots" {
+			return &MockCommandExecutor{err: makeExitError(2), output: []byte("CRIT: tank/data has no daily snapshots at all!\n")}
+		}
+		return &MockCommandExecutor{output: []byte("OK")}
+	}
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	byUID := entriesByUID(entries)
+	assert.Len(t, byUID, 2*len(models.PropStr))
+
+	severity := byUID["host_sanoid_snapshots"]
+	assert.Equal(t, "sensor", severity.Domain)
+	assert.Equal(t, "enum", severity.Config.DeviceClass)
+	assert.Equal(t, []byte("Critical"), severity.Payload)
+	assert.JSONEq(t, `{"crit": ["tank/data"], "warn": [], "messages": ["CRIT: tank/data has no daily snapshots at all!"]}`, string(severity.Attributes))
+	assert.Equal(t, []byte("ON"), byUID["host_pool_snapshots"].Payload)
+	assert.Equal(t, []byte("Ok"), byUID["host_sanoid_health"].Payload)
+	assert.Equal(t, []byte("OFF"), byUID["host_pool_health"].Payload)
+}
+
+func TestGetPoolStateTimeout(t *testing.T) {
+	mockRun := func(ctx context.Context, name string, _ ...string) commandExecutor {
+		assert.Equal(t, "/usr/local/sbin/sanoid", name)
+		<-ctx.Done()
+		return &MockCommandExecutor{err: makeExitError(1)}
+	}
+	result, _, _, err := getPoolState(context.Background(), mockRun, "/usr/local/sbin/sanoid", 10*time.Millisecond, models.Snaphots)
+	assert.ErrorIs(t, err, errTimeout)
+	assert.False(t, result)
+}
+
+func TestEntriesConcurrentTimeout(t *testing.T) {
+	provider := NewSanoidProvider(models.ZFSdefault().Sanoid, models.Device{Name: "host"}, time.Minute)
+	provider.timeout = 20 * time.Millisecond
+	started := make(chan struct{}, len(models.PropStr))
+	provider.shellExec = func(ctx context.Context, _ string, arg ...string) commandExecutor {
+		started <- struct{}{}
+		if arg[0] == "--monitor-snapshots" {
+			<-ctx.Done()
+			return &MockCommandExecutor{err: ctx.Err()}
+		}
+		// Only returns once all monitors have started, so the monitors must run concurrently
+		for len(started) < len(models.PropStr) {
+			time.Sleep(time.Millisecond)
+		}
+		return &MockCommandExecutor{output: []byte("OK")}
+	}
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err, "Expected a timeout not to fail the other monitors")
+	byUID := entriesByUID(entries)
+	assert.Equal(t, []byte("Timeout"), byUID["host_sanoid_snapshots"].Payload)
+	assert.Equal(t, []byte("None"), byUID["host_pool_snapshots"].Payload)
+	assert.Contains(t, string(byUID["host_sanoid_snapshots"].Attributes), "timed out after 20ms")
+	assert.Equal(t, []byte("Ok"), byUID["host_sanoid_health"].Payload)
+}
+
+func TestEntriesFailedMonitor(t *testing.T) {
+	provider := NewSanoidProvider(models.ZFSdefault().Sanoid, models.Device{Name: "host"}, time.Minute)
+	provider.shellExec = func(_ context.Context, _ string, arg ...string) commandExecutor {
+		if arg[0] == "--monitor-capacity" {
+			return &MockCommandExecutor{err: exec.ErrNotFound}
+		}
+		return &MockCommandExecutor{output: []byte("OK")}
+	}
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err, "Expected a failed monitor not to drop the others")
+	byUID := entriesByUID(entries)
+	assert.Len(t, byUID, 2*len(models.PropStr))
+	assert.Equal(t, []byte("Error"), byUID["host_sanoid_capacity"].Payload)
+	assert.Equal(t, []byte("None"), byUID["host_pool_capacity"].Payload)
+	assert.Contains(t, string(byUID["host_sanoid_capacity"].Attributes), exec.ErrNotFound.Error())
+	assert.Equal(t, []byte("Ok"), byUID["host_sanoid_health"].Payload)
+	assert.Equal(t, []byte("OFF"), byUID["host_pool_snapshots"].Payload)
+}
+
+func TestMonitorCommandKillsChildren(t *testing.T) {
+	// The background sleep inherits the output pipe, like the zfs children of sanoid
+	run := func(ctx context.Context, _ string, _ ...string) commandExecutor {
+		return monitorCommand(ctx, "sh", "-c", "sleep 30 & sleep 30")
+	}
+	start := time.Now()
+	_, _, _, err := getPoolState(context.Background(), run, "sanoid", 100*time.Millisecond, models.Health)
+	assert.ErrorIs(t, err, errTimeout)
+	assert.Less(t, time.Since(start), monitorWaitDelay, "Expected the process group to be killed without waiting for the pipe")
+}
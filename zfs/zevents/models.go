@@ -0,0 +1,29 @@
+package zevents
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+type eventExecutor interface {
+	StdoutPipe() (io.ReadCloser, error)
+	Start() error
+	Wait() error
+}
+
+// One event as printed by `zpool events -v -H`
+type zpoolEvent struct {
+	Time   time.Time
+	Class  string
+	Fields map[string]string
+}
+
+// EventProvider follows `zpool events` and publishes relevant events to a Home Assistant event entity.
+type EventProvider struct {
+	config     models.MqttConfig
+	retryDelay time.Duration
+	execFn     func(context.Context, string, ...string) eventExecutor
+}
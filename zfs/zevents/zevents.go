@@ -0,0 +1,248 @@
+// Package zevents provides a ZFS provider that follows `zpool events -f` to publish pool events as they happen.
+package zevents
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+var Logger zerolog.Logger
+
+// Event types of the Home Assistant event entity
+var eventTypes = []string{"fault", "checksum", "io", "statechange", "scrub_finish", "resilver_finish"}
+
+// Names of `vdev_state` values in statechange events
+var vdevStates = map[uint64]string{
+	0: "UNKNOWN",
+	1: "CLOSED",
+	2: "OFFLINE",
+	3: "REMOVED",
+	4: "CANT_OPEN",
+	5: "FAULTED",
+	6: "DEGRADED",
+	7: "ONLINE",
+}
+
+// getEventType maps a ZFS event class to an event type, or returns "" for events that are not published.
+func getEventType(class string) string {
+	switch class {
+	case "ereport.fs.zfs.checksum":
+		return "checksum"
+	case "ereport.fs.zfs.io":
+		return "io"
+	case "resource.fs.zfs.statechange":
+		return "statechange"
+	case "sysevent.fs.zfs.scrub_finish":
+		return "scrub_finish"
+	case "sysevent.fs.zfs.resilver_finish":
+		return "resilver_finish"
+	case "resource.fs.zfs.removed":
+		return "fault"
+	}
+	if strings.HasPrefix(class, "ereport.fs.zfs.") {
+		return "fault"
+	}
+	return ""
+}
+
+// parseHeader splits an event header line like "Oct  8 2026 10:00:00.123456789\tsysevent.fs.zfs.scrub_finish".
+func parseHeader(line string) (time.Time, string, bool) {
+	i := strings.LastIndexByte(line, '\t')
+	if i < 0 {
+		i = strings.LastIndexByte(line, ' ')
+	}
+	if i < 0 {
+		return time.Time{}, "", false
+	}
+	t, err := time.ParseInLocation("Jan _2 2006 15:04:05.000000000", strings.TrimSpace(line[:i]), time.Local)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return t, strings.TrimSpace(line[i+1:]), true
+}
+
+// unquote returns the quoted part of a value like `"FAULTED" (0x5)`, or the value itself if unquoted.
+func unquote(value string) string {
+	if !strings.HasPrefix(value, `"`) {
+		return value
+	}
+	quoted, _, _ := strings.Cut(value[1:], `"`)
+	return quoted
+}
+
+// parseEvents reads the output of `zpool events -v -H` and calls emit for every complete event.
+// Only top-level fields are kept, embedded nvlists like the detector are skipped.
+func parseEvents(r io.Reader, emit func(zpoolEvent)) error {
+	scanner := bufio.NewScanner(r)
+	var current *zpoolEvent
+	nested := 0
+	flush := func() {
+		if current != nil {
+			emit(*current)
+		}
+		current = nil
+		nested = 0
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+		case line[0] == ' ' || line[0] == '\t':
+			if current == nil {
+				continue
+			}
+			if strings.HasPrefix(trimmed, "(start ") {
+				nested++
+				continue
+			}
+			if strings.HasPrefix(trimmed, "(end ") {
+				nested--
+				continue
+			}
+			key, value, ok := strings.Cut(trimmed, " = ")
+			if !ok {
+				continue
+			}
+			if value == "(embedded nvlist)" {
+				nested++
+				continue
+			}
+			if nested == 0 {
+				current.Fields[key] = unquote(value)
+			}
+		default:
+			flush()
+			t, class, ok := parseHeader(line)
+			if !ok {
+				Logger.Debug().Str("mod", "zevents").Str("line", line).Msg("Unexpected event header")
+				continue
+			}
+			current = &zpoolEvent{Time: t, Class: class, Fields: map[string]string{}}
+		}
+	}
+	flush()
+	return scanner.Err()
+}
+
+// getEventConfig returns the MqttConfig for the ZFS event entity of the host.
+func getEventConfig(device models.Device) models.MqttConfig {
+	uniqueID := mqttclient.NormalizeStr(device.Name) + "_zfs_events"
+	return models.MqttConfig{
+		Name:       "ZFS events",
+		StateTopic: "homeassistant/event/" + uniqueID + "/state",
+		UniqueID:   uniqueID,
+		Device:     device,
+		EventTypes: eventTypes,
+	}
+}
+
+// NewEventProvider returns a provider that follows `zpool events`.
+func NewEventProvider(device models.Device) *EventProvider {
+	return &EventProvider{
+		config:     getEventConfig(device),
+		retryDelay: time.Minute,
+		execFn: func(ctx context.Context, name string, arg ...string) eventExecutor {
+			return exec.CommandContext(ctx, name, arg...)
+		},
+	}
+}
+
+// eventEntry converts a ZFS event to an event entity entry. Returns false for events that are not published.
+func (p *EventProvider) eventEntry(ev zpoolEvent) (models.Entry, bool) {
+	eventType := getEventType(ev.Class)
+	if eventType == "" {
+		return models.Entry{}, false
+	}
+	m := map[string]any{
+		"event_type": eventType,
+		"class":      ev.Class,
+		"time":       ev.Time.UTC().Format(time.RFC3339),
+	}
+	if pool, ok := ev.Fields["pool"]; ok {
+		m["pool"] = pool
+	}
+	if vdev, ok := ev.Fields["vdev_path"]; ok {
+		m["vdev"] = vdev
+	} else if guid, ok := ev.Fields["vdev_guid"]; ok {
+		m["vdev"] = guid
+	}
+	if raw, ok := ev.Fields["vdev_state"]; ok {
+		if state, err := strconv.ParseUint(raw, 0, 64); err == nil {
+			m["vdev_state"] = vdevStates[state]
+		} else {
+			m["vdev_state"] = raw
+		}
+	}
+	payload, err := json.Marshal(m)
+	if err != nil {
+		Logger.Error().Str("mod", "zevents").Err(err).Msg("")
+		return models.Entry{}, false
+	}
+	return models.Entry{Config: p.config, Domain: "event", Payload: payload}, true
+}
+
+// Entries returns the event entity for discovery. Its state is only published by Watch.
+func (p *EventProvider) Entries(_ context.Context) ([]models.Entry, error) {
+	return []models.Entry{{Config: p.config, Domain: "event"}}, nil
+}
+
+// follow runs `zpool events -f` until it exits and sends events newer than since.
+// Returns the time of the last event seen.
+func (p *EventProvider) follow(ctx context.Context, since time.Time, out chan<- models.Entry) (time.Time, error) {
+	cmd := p.execFn(ctx, "zpool", "events", "-f", "-v", "-H")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return since, err
+	}
+	if err := cmd.Start(); err != nil {
+		return since, err
+	}
+	parseErr := parseEvents(stdout, func(ev zpoolEvent) {
+		if !ev.Time.After(since) {
+			return
+		}
+		since = ev.Time
+		entry, ok := p.eventEntry(ev)
+		if !ok {
+			return
+		}
+		Logger.Info().Str("mod", "zevents").Str("class", ev.Class).Str("pool", ev.Fields["pool"]).Msg("ZFS event")
+		select {
+		case out <- entry:
+		case <-ctx.Done():
+		}
+	})
+	return since, errors.Join(parseErr, cmd.Wait())
+}
+
+// Watch is a long-running routine that follows `zpool events` and restarts it if it exits.
+// Events from before the start of the routine are skipped.
+func (p *EventProvider) Watch(ctx context.Context, out chan<- models.Entry) {
+	since := time.Now()
+	for {
+		var err error
+		since, err = p.follow(ctx, since, out)
+		if ctx.Err() != nil {
+			return
+		}
+		Logger.Error().Str("mod", "zevents").Err(err).Msg("zpool events exited")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.retryDelay):
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package zevents
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+type mockEventCmd struct {
+	data []byte
+}
+
+func (m *mockEventCmd) StdoutPipe() (io.ReadCloser, error) {
+	return io.NopCloser(strings.NewReader(string(m.data))), nil
+}
+func (m *mockEventCmd) Start() error { return nil }
+func (m *mockEventCmd) Wait() error  { return nil }
+
+func readFixture(t *testing.T) []zpoolEvent {
+	t.Helper()
+	file, err := os.Open("events.txt")
+	require.NoError(t, err)
+	defer file.Close()
+	var events []zpoolEvent
+	require.NoError(t, parseEvents(file, func(ev zpoolEvent) { events = append(events, ev) }))
+	return events
+}
+
+func TestParseEvents(t *testing.T) {
+	events := readFixture(t)
+	require.Len(t, events, 4)
+	checksum := events[1]
+	assert.Equal(t, "ereport.fs.zfs.checksum", checksum.Class)
+	assert.Equal(t, time.Date(2026, 10, 18, 10, 5, 12, 123456789, time.Local), checksum.Time)
+	assert.Equal(t, "tank", checksum.Fields["pool"], "Expected nested detector pool to be skipped")
+	assert.Equal(t, "/dev/disk/by-id/ata-WDC_WD40EFRX-part1", checksum.Fields["vdev_path"])
+	assert.Equal(t, "FAULTED", events[2].Fields["vdev_state"])
+}
+
+func TestParseHeaderPaddedDay(t *testing.T) {
+	ts, class, ok := parseHeader("Oct  8 2026 11:00:00.000000000 resource.fs.zfs.statechange")
+	require.True(t, ok)
+	assert.Equal(t, "resource.fs.zfs.statechange", class)
+	assert.Equal(t, 8, ts.Day())
+}
+
+func TestGetEventType(t *testing.T) {
+	assert.Equal(t, "checksum", getEventType("ereport.fs.zfs.checksum"))
+	assert.Equal(t, "io", getEventType("ereport.fs.zfs.io"))
+	assert.Equal(t, "fault", getEventType("ereport.fs.zfs.vdev.open_failed"))
+	assert.Equal(t, "scrub_finish", getEventType("sysevent.fs.zfs.scrub_finish"))
+	assert.Equal(t, "", getEventType("sysevent.fs.zfs.history_event"))
+}
+
+func TestEventEntry(t *testing.T) {
+	provider := NewEventProvider(models.Device{Name: "host"})
+	events := readFixture(t)
+
+	_, ok := provider.eventEntry(events[0])
+	assert.False(t, ok, "Expected history events to be skipped")
+
+	entry, ok := provider.eventEntry(events[2])
+	require.True(t, ok)
+	assert.Equal(t, "event", entry.Domain)
+	var payload map[string]any
+	require.NoError(t, json.Unmarshal(entry.Payload, &payload))
+	assert.Equal(t, "statechange", payload["event_type"])
+	assert.Equal(t, "tank", payload["pool"])
+	assert.Equal(t, "/dev/disk/by-id/ata-WDC_WD40EFRX-part1", payload["vdev"])
+	assert.Equal(t, "FAULTED", payload["vdev_state"])
+}
+
+func TestEntriesDiscoveryOnly(t *testing.T) {
+	provider := NewEventProvider(models.Device{Name: "host"})
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Nil(t, entries[0].Payload)
+	assert.Equal(t, eventTypes, entries[0].Config.EventTypes)
+}
+
+func TestFollowSkipsOldEvents(t *testing.T) {
+	data, err := os.ReadFile("events.txt")
+	require.NoError(t, err)
+	provider := NewEventProvider(models.Device{Name: "host"})
+	provider.execFn = func(_ context.Context, _ string, _ ...string) eventExecutor { return &mockEventCmd{data: data} }
+
+	out := make(chan models.Entry, 10)
+	since := time.Date(2026, 10, 18, 10, 30, 0, 0, time.Local)
+	last, err := provider.follow(context.Background(), since, out)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2026, 10, 18, 12, 30, 0, 0, time.Local), last)
+	assert.Len(t, out, 2, "Expected only statechange and scrub_finish")
+}
@@ -9,39 +9,65 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/ykgmfq/SystemPub/models"
 	"github.com/ykgmfq/SystemPub/mqttclient"
+	"github.com/ykgmfq/SystemPub/zfs/arcstats"
+	"github.com/ykgmfq/SystemPub/zfs/dataset"
+	"github.com/ykgmfq/SystemPub/zfs/disk"
 	"github.com/ykgmfq/SystemPub/zfs/sanoid"
+	"github.com/ykgmfq/SystemPub/zfs/zevents"
 	"github.com/ykgmfq/SystemPub/zfs/zpool"
 )
 
 var Logger zerolog.Logger
 
+// Delay before refreshing all providers after the first of a burst of watcher or block device events, so the burst triggers a single refresh.
+// Later events of the burst do not postpone it, so a steady stream of events still refreshes within this delay.
+const refreshDelay = 5 * time.Second
+
 // ZfsServer runs all ZFS providers on a ticker and publishes to MQTT.
 type ZfsServer struct {
 	Discover  chan bool
+	Commands  chan *paho.Publish
 	providers []Provider
 	interval  time.Duration
 	pubs      chan *paho.Publish
+	events    chan models.Entry
+	monitor   *disk.Monitor
+	hotplug   chan string
 }
 
-func NewZfsServer(pubs chan *paho.Publish, device models.Device, interval time.Duration) ZfsServer {
+func NewZfsServer(pubs chan *paho.Publish, device models.Device, interval time.Duration, config models.ZFS, stateDir string) ZfsServer {
+	providers := []Provider{
+		sanoid.NewSanoidProvider(config.Sanoid, device, interval),
+		sanoid.NewFreshnessProvider(config.Sanoid, device, interval),
+		sanoid.NewRetentionProvider(config.Sanoid, device, interval),
+		zpool.NewZpoolProvider(config.Zpool, stateDir, interval),
+		zpool.NewIostatProvider(interval),
+		zpool.NewPropsProvider(interval),
+		zpool.NewSmartProvider(config.Zpool, interval),
+		zevents.NewEventProvider(device),
+		arcstats.NewArcProvider(config.Arcstats, device, interval),
+		dataset.NewEncryptionProvider(config.Encryption, device, interval),
+		dataset.NewMountProvider(device, interval),
+		dataset.NewDriftProvider(config.Drift, device, interval),
+		dataset.NewUserspaceProvider(config.Userspace, device, interval),
+	}
+	if config.HardwareActions {
+		providers = append(providers, zpool.NewLocateProvider(config.Zpool, interval))
+	}
 	return ZfsServer{
 		Discover:  make(chan bool),
-		providers: []Provider{sanoid.NewSanoidProvider(device, interval), zpool.NewZpoolProvider(interval)},
+		Commands:  make(chan *paho.Publish, 4),
+		providers: providers,
 		interval:  interval,
 		pubs:      pubs,
+		events:    make(chan models.Entry),
+		monitor:   disk.NewMonitor(),
+		hotplug:   make(chan string),
 	}
 }
 
 func (s ZfsServer) publishDiscovery(e models.Entry) error {
-	var (
-		msg *paho.Publish
-		err error
-	)
-	if e.Domain == "sensor" {
-		msg, err = mqttclient.GetSensorDiscovery(e.Config)
-	} else {
-		msg, err = mqttclient.GetDiscovery(e.Config)
-	}
+	msg, err := mqttclient.GetDomainDiscovery(e.Domain, e.Config)
 	if err != nil {
 		return err
 	}
@@ -50,6 +76,9 @@ func (s ZfsServer) publishDiscovery(e models.Entry) error {
 }
 
 func (s ZfsServer) publishState(e models.Entry) {
+	if e.Payload == nil {
+		return
+	}
 	s.pubs <- &paho.Publish{Topic: e.Config.StateTopic, Payload: e.Payload, Retain: true}
 	if e.Attributes != nil {
 		s.pubs <- &paho.Publish{Topic: e.Config.JsonAttributesTopic, Payload: e.Attributes, Retain: true}
@@ -71,21 +100,56 @@ func (s ZfsServer) discoverAll(ctx context.Context) {
 	}
 }
 
+func (s ZfsServer) update(ctx context.Context, p Provider) {
+	entries, err := p.Entries(ctx)
+	if err != nil {
+		Logger.Error().Str("mod", "zfs").Err(err).Msg("")
+		return
+	}
+	for _, e := range entries {
+		s.publishState(e)
+	}
+}
+
 func (s ZfsServer) updateAll(ctx context.Context) {
 	for _, p := range s.providers {
-		entries, err := p.Entries(ctx)
-		if err != nil {
-			Logger.Error().Str("mod", "zfs").Err(err).Msg("")
+		s.update(ctx, p)
+	}
+}
+
+// command passes a command to the provider of its entity and publishes the new state.
+func (s ZfsServer) command(ctx context.Context, cmd *paho.Publish) {
+	for _, p := range s.providers {
+		c, ok := p.(Commander)
+		if !ok {
 			continue
 		}
-		for _, e := range entries {
-			s.publishState(e)
+		handled, err := c.Command(ctx, cmd.Topic, cmd.Payload)
+		if err != nil {
+			Logger.Error().Str("mod", "zfs").Str("topic", cmd.Topic).Err(err).Msg("Command failed")
+		}
+		if handled {
+			s.update(ctx, p)
+			return
 		}
 	}
+	Logger.Debug().Str("mod", "zfs").Str("topic", cmd.Topic).Msg("No provider for command")
 }
 
 func (s ZfsServer) Serve(ctx context.Context) {
+	for _, p := range s.providers {
+		if w, ok := p.(Watcher); ok {
+			go w.Watch(ctx, s.events)
+		}
+	}
+	go s.monitor.Watch(ctx, s.hotplug)
 	ticker := time.NewTicker(s.interval)
+	refresh := time.NewTimer(refreshDelay)
+	refresh.Stop()
+	refreshPending := false
+	rediscover := time.NewTimer(refreshDelay)
+	rediscover.Stop()
+	rediscoverPending := false
 	for {
 		select {
 		case <-ctx.Done():
@@ -97,6 +161,29 @@ func (s ZfsServer) Serve(ctx context.Context) {
 			Logger.Debug().Str("mod", "zfs").Msg("Discovery")
 			s.discoverAll(ctx)
 			s.updateAll(ctx)
+		case cmd := <-s.Commands:
+			s.command(ctx, cmd)
+		case e := <-s.events:
+			s.publishState(e)
+			if !refreshPending {
+				refresh.Reset(refreshDelay)
+				refreshPending = true
+			}
+		case <-s.hotplug:
+			if !rediscoverPending {
+				rediscover.Reset(refreshDelay)
+				rediscoverPending = true
+			}
+		case <-rediscover.C:
+			rediscoverPending = false
+			// Added disks need discovery for their sensors
+			Logger.Info().Str("mod", "zfs").Msg("Block devices changed")
+			s.discoverAll(ctx)
+			s.updateAll(ctx)
+		case <-refresh.C:
+			refreshPending = false
+			Logger.Debug().Str("mod", "zfs").Msg("Refresh after event")
+			s.updateAll(ctx)
 		case <-ticker.C:
 			s.updateAll(ctx)
 		}
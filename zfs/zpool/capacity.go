@@ -0,0 +1,110 @@
+package zpool
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// Capacity states, as options of the capacity state enum sensor
+const (
+	capacityOK       = "ok"
+	capacityWarning  = "warning"
+	capacityCritical = "critical"
+)
+
+var capacityStates = []string{capacityOK, capacityWarning, capacityCritical}
+
+// validThresholds reports whether both thresholds are percentages and the warning does not exceed the critical one.
+func validThresholds(t models.CapacityThresholds) bool {
+	return t.Warning > 0 && t.Critical <= 100 && t.Warning <= t.Critical
+}
+
+// validateCapacity returns the config with invalid thresholds replaced, logging an error for each.
+// Invalid defaults fall back to the built-in defaults, invalid pool thresholds to the defaults.
+func validateCapacity(config models.Zpool) models.Zpool {
+	if !validThresholds(config.Capacity) {
+		Logger.Error().Str("mod", "zpool").Int("warning", config.Capacity.Warning).Int("critical", config.Capacity.Critical).Msg("Invalid capacity thresholds, using the defaults")
+		config.Capacity = models.ZFSdefault().Zpool.Capacity
+	}
+	pools := make(map[string]models.CapacityThresholds, len(config.PoolCapacity))
+	for pool, override := range config.PoolCapacity {
+		merged := mergeThresholds(config.Capacity, override)
+		if override.Warning < 0 || override.Critical < 0 || !validThresholds(merged) {
+			Logger.Error().Str("mod", "zpool").Str("pool", pool).Int("warning", merged.Warning).Int("critical", merged.Critical).Msg("Invalid pool capacity thresholds, using the defaults")
+			continue
+		}
+		pools[pool] = override
+	}
+	config.PoolCapacity = pools
+	return config
+}
+
+// mergeThresholds returns the thresholds with the values the override sets.
+func mergeThresholds(thresholds, override models.CapacityThresholds) models.CapacityThresholds {
+	if override.Warning > 0 {
+		thresholds.Warning = override.Warning
+	}
+	if override.Critical > 0 {
+		thresholds.Critical = override.Critical
+	}
+	return thresholds
+}
+
+// capacityThresholds returns the thresholds of a pool, with the defaults for values the pool does not set.
+func (p *ZpoolProvider) capacityThresholds(pool string) models.CapacityThresholds {
+	return mergeThresholds(p.config.Capacity, p.config.PoolCapacity[pool])
+}
+
+// getCapacityState maps the used percentage of a pool to its capacity state.
+func getCapacityState(used float64, thresholds models.CapacityThresholds) string {
+	switch {
+	case used >= float64(thresholds.Critical):
+		return capacityCritical
+	case used >= float64(thresholds.Warning):
+		return capacityWarning
+	default:
+		return capacityOK
+	}
+}
+
+// buildCapacityEntries constructs the capacity state enum sensor and the capacity problem sensor.
+func (p *ZpoolProvider) buildCapacityEntries(pool *zpoolPool) []zpoolSensorEntry {
+	rootVdev := pool.Vdevs[pool.Name]
+	if rootVdev == nil || rootVdev.TotalSpace == 0 {
+		return nil
+	}
+	device := zpoolDevice(pool)
+	guid := pool.PoolGUID
+	used := float64(rootVdev.AllocSpace) / float64(rootVdev.TotalSpace) * 100
+	thresholds := p.capacityThresholds(pool.Name)
+	state := getCapacityState(used, thresholds)
+
+	stateCfg := makeSensorConfig("Capacity state", zpoolSensorUID(guid, "capacity_state"), "sensor", "enum", "", "", device, p.interval)
+	stateCfg.Options = capacityStates
+	problemUID := zpoolSensorUID(guid, "capacity_problem")
+	problemCfg := makeSensorConfig("Capacity problem", problemUID, "binary_sensor", "problem", "", "", device, p.interval)
+	problemCfg.JsonAttributesTopic = zpoolAttrTopic("binary_sensor", problemUID)
+	return []zpoolSensorEntry{
+		{
+			config:  stateCfg,
+			domain:  "sensor",
+			payload: func() []byte { return []byte(state) },
+		},
+		{
+			config:  problemCfg,
+			domain:  "binary_sensor",
+			payload: func() []byte { return mqttclient.ProblemPayload(state == capacityOK) },
+			attrs: func() ([]byte, error) {
+				return json.Marshal(map[string]any{
+					"used_percent": fmt.Sprintf("%.1f", used),
+					"warning":      thresholds.Warning,
+					"critical":     thresholds.Critical,
+					"state":        state,
+				})
+			},
+		},
+	}
+}
@@ -0,0 +1,59 @@
+package zpool
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func TestGetCapacityState(t *testing.T) {
+	thresholds := models.CapacityThresholds{Warning: 80, Critical: 90}
+	assert.Equal(t, capacityOK, getCapacityState(79.9, thresholds))
+	assert.Equal(t, capacityWarning, getCapacityState(80, thresholds))
+	assert.Equal(t, capacityCritical, getCapacityState(95, thresholds))
+}
+
+func TestCapacityThresholds(t *testing.T) {
+	config := models.ZFSdefault().Zpool
+	config.PoolCapacity = map[string]models.CapacityThresholds{"backup": {Critical: 95}, "media": {Warning: 92}, "scratch": {Warning: 85, Critical: 120}}
+	provider := NewZpoolProvider(config, "", 20*time.Minute)
+	assert.Equal(t, models.CapacityThresholds{Warning: 80, Critical: 90}, provider.capacityThresholds("tank"))
+	assert.Equal(t, models.CapacityThresholds{Warning: 80, Critical: 95}, provider.capacityThresholds("backup"),
+		"Expected unset values to fall back to the defaults")
+	assert.Equal(t, models.CapacityThresholds{Warning: 80, Critical: 90}, provider.capacityThresholds("media"),
+		"Expected a warning above the critical threshold to be rejected")
+	assert.Equal(t, models.CapacityThresholds{Warning: 80, Critical: 90}, provider.capacityThresholds("scratch"),
+		"Expected a threshold above 100 to be rejected")
+
+	config.Capacity = models.CapacityThresholds{Warning: 95, Critical: 90}
+	config.PoolCapacity = nil
+	provider = NewZpoolProvider(config, "", 20*time.Minute)
+	assert.Equal(t, models.CapacityThresholds{Warning: 80, Critical: 90}, provider.capacityThresholds("tank"),
+		"Expected invalid defaults to fall back to the built-in defaults")
+}
+
+func TestCapacityEntries(t *testing.T) {
+	provider := NewZpoolProvider(models.ZFSdefault().Zpool, "", 20*time.Minute)
+	pool := &zpoolPool{Name: "tank", PoolGUID: 7, Vdevs: map[string]*vdev{"tank": {Name: "tank", AllocSpace: 850, TotalSpace: 1000}}}
+	entries, err := toEntries(provider.buildCapacityEntries(pool))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	state := entries[0]
+	assert.Equal(t, zpoolSensorUID(7, "capacity_state"), state.Config.UniqueID)
+	assert.Equal(t, capacityStates, state.Config.Options)
+	assert.Equal(t, []byte("warning"), state.Payload)
+
+	problem := entries[1]
+	assert.Equal(t, []byte("ON"), problem.Payload)
+	var attrs map[string]any
+	require.NoError(t, json.Unmarshal(problem.Attributes, &attrs))
+	assert.Equal(t, "85.0", attrs["used_percent"])
+	assert.Equal(t, float64(90), attrs["critical"])
+
+	assert.Empty(t, provider.buildCapacityEntries(&zpoolPool{Name: "empty"}))
+}
@@ -0,0 +1,130 @@
+package zpool
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// States of a hot spare, as options of its enum sensor
+var spareStates = []string{"AVAIL", "INUSE", "UNAVAIL", "FAULTED", "REMOVED", "OFFLINE", "UNKNOWN"}
+
+// Allocation classes outside the normal data vdevs, with their key and name prefix
+var vdevClasses = []struct {
+	key   string
+	name  string
+	vdevs func(*zpoolPool) map[string]*vdev
+}{
+	{"log_", "Log ", func(p *zpoolPool) map[string]*vdev { return p.Logs }},
+	{"cache_", "Cache ", func(p *zpoolPool) map[string]*vdev { return p.L2cache }},
+	{"special_", "Special ", func(p *zpoolPool) map[string]*vdev { return p.Special }},
+	{"dedup_", "Dedup ", func(p *zpoolPool) map[string]*vdev { return p.Dedup }},
+}
+
+// A leaf vdev with the key and name prefix of its allocation class
+type poolLeaf struct {
+	vdev      *vdev
+	classKey  string
+	className string
+}
+
+// poolLeaves returns the leaf vdevs of all allocation classes, plus the hot spares that are not in use.
+func poolLeaves(pool *zpoolPool) []poolLeaf {
+	var leaves []poolLeaf
+	seen := map[string]bool{}
+	add := func(top *vdev, classKey, className string) {
+		for _, leaf := range collectLeafVdevs(top) {
+			seen[leaf.Name] = true
+			leaves = append(leaves, poolLeaf{leaf, classKey, className})
+		}
+	}
+	if rootVdev := pool.Vdevs[pool.Name]; rootVdev != nil {
+		add(rootVdev, "", "")
+	}
+	for _, class := range vdevClasses {
+		for _, top := range class.vdevs(pool) {
+			add(top, class.key, class.name)
+		}
+	}
+	for _, spare := range pool.Spares {
+		if !seen[spare.Name] {
+			leaves = append(leaves, poolLeaf{spare, "spare_", "Spare "})
+		}
+	}
+	return leaves
+}
+
+// buildClassCapacityEntries constructs the capacity sensors of a special or dedup vdev.
+func buildClassCapacityEntries(top *vdev, classKey, className string, device models.Device, guid uint64, interval time.Duration) []zpoolSensorEntry {
+	key := classKey + mqttclient.NormalizeStr(top.Name)
+	allocVal := float64(top.AllocSpace) / gib
+	totalVal := float64(top.TotalSpace) / gib
+	var usedVal float64
+	if top.TotalSpace > 0 {
+		usedVal = float64(top.AllocSpace) / float64(top.TotalSpace) * 100
+	}
+	return []zpoolSensorEntry{
+		{
+			config:  makeSensorConfig(className+top.Name+" allocated space", zpoolSensorUID(guid, key+"_alloc"), "sensor", "data_size", "measurement", "GiB", device, interval),
+			domain:  "sensor",
+			payload: func() []byte { return []byte(fmt.Sprintf("%.2f", allocVal)) },
+		},
+		{
+			config:  makeSensorConfig(className+top.Name+" total space", zpoolSensorUID(guid, key+"_total"), "sensor", "data_size", "measurement", "GiB", device, interval),
+			domain:  "sensor",
+			payload: func() []byte { return []byte(fmt.Sprintf("%.2f", totalVal)) },
+		},
+		{
+			config:  makeSensorConfig(className+top.Name+" capacity", zpoolSensorUID(guid, key+"_capacity"), "sensor", "", "measurement", "%", device, interval),
+			domain:  "sensor",
+			payload: func() []byte { return []byte(fmt.Sprintf("%.1f", usedVal)) },
+		},
+	}
+}
+
+// buildClassEntries constructs the sensors for log, cache, special and dedup devices and hot spares.
+func buildClassEntries(pool *zpoolPool, disks poolDisks, device models.Device, interval time.Duration) []zpoolSensorEntry {
+	guid := pool.PoolGUID
+	var entries []zpoolSensorEntry
+	for _, class := range vdevClasses {
+		for _, top := range class.vdevs(pool) {
+			for _, leaf := range collectLeafVdevs(top) {
+				entries = append(entries, buildDiskEntries(leaf, class.key, class.name, disks, device, guid, interval)...)
+			}
+			if class.key == "special_" || class.key == "dedup_" {
+				entries = append(entries, buildClassCapacityEntries(top, class.key, class.name, device, guid, interval)...)
+			}
+		}
+	}
+
+	if len(pool.Spares) == 0 {
+		return entries
+	}
+	available := 0
+	for _, spare := range pool.Spares {
+		state := spare.State
+		if !slices.Contains(spareStates, state) {
+			state = "UNKNOWN"
+		}
+		if state == "AVAIL" {
+			available++
+		}
+		cfg := makeSensorConfig(disks.label(spare, "Spare "), zpoolSensorUID(guid, "spare_"+mqttclient.NormalizeStr(spare.Name)), "sensor", "enum", "", "", device, interval)
+		cfg.Options = spareStates
+		entries = append(entries, zpoolSensorEntry{
+			config:  cfg,
+			domain:  "sensor",
+			payload: func() []byte { return []byte(state) },
+		})
+	}
+	entries = append(entries, zpoolSensorEntry{
+		config:  makeSensorConfig("Spares available", zpoolSensorUID(guid, "spares_available"), "sensor", "", "measurement", "", device, interval),
+		domain:  "sensor",
+		payload: func() []byte { return []byte(strconv.Itoa(available)) },
+	})
+	return entries
+}
@@ -0,0 +1,72 @@
+package zpool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunZpoolClasses(t *testing.T) {
+	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus3.json"))
+	require.NoError(t, err)
+	pool := status.Pools["tank"]
+	require.NotNil(t, pool)
+	assert.Len(t, pool.Logs, 1)
+	assert.Len(t, pool.L2cache, 1)
+	assert.Len(t, pool.Special, 1)
+	assert.Len(t, pool.Spares, 2)
+	assert.Equal(t, "special", pool.Special["mirror-2"].Class)
+}
+
+func TestBuildClassEntries(t *testing.T) {
+	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus3.json"))
+	require.NoError(t, err)
+	pool := status.Pools["tank"]
+	guid := pool.PoolGUID
+	byUID := map[string]zpoolSensorEntry{}
+	for _, e := range buildClassEntries(pool, poolDisks{}, zpoolDevice(pool), 20*time.Minute) {
+		byUID[e.config.UniqueID] = e
+	}
+
+	logHealth := byUID[zpoolSensorUID(guid, "log_nvme0n1p1_health")]
+	assert.Equal(t, "Log nvme0n1p1 health", logHealth.config.Name)
+	assert.Equal(t, []byte("OFF"), logHealth.payload())
+
+	cacheErrors := byUID[zpoolSensorUID(guid, "cache_sdc_read_errors")]
+	assert.Equal(t, "Cache sdc read errors", cacheErrors.config.Name)
+	assert.Equal(t, []byte("3"), cacheErrors.payload())
+
+	capacity := byUID[zpoolSensorUID(guid, "special_mirror-2_capacity")]
+	assert.Equal(t, "Special mirror-2 capacity", capacity.config.Name)
+	assert.Equal(t, []byte("10.0"), capacity.payload())
+
+	spare := byUID[zpoolSensorUID(guid, "spare_sde")]
+	assert.Equal(t, "enum", spare.config.DeviceClass)
+	assert.Equal(t, spareStates, spare.config.Options)
+	assert.Equal(t, []byte("INUSE"), spare.payload())
+	assert.Equal(t, []byte("AVAIL"), byUID[zpoolSensorUID(guid, "spare_sdd")].payload())
+	assert.Equal(t, []byte("1"), byUID[zpoolSensorUID(guid, "spares_available")].payload())
+}
+
+func TestBuildClassEntriesNone(t *testing.T) {
+	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus.json"))
+	require.NoError(t, err)
+	pool := status.Pools["data"]
+	assert.Empty(t, buildClassEntries(pool, poolDisks{}, zpoolDevice(pool), 20*time.Minute))
+}
+
+func TestRedundancyIncludesSpecial(t *testing.T) {
+	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus3.json"))
+	require.NoError(t, err)
+	pool := status.Pools["tank"]
+	byUID := map[string]zpoolSensorEntry{}
+	for _, e := range buildRedundancyEntries(pool, zpoolDevice(pool), 20*time.Minute) {
+		byUID[e.config.UniqueID] = e
+	}
+	assert.Equal(t, []byte("1"), byUID[zpoolSensorUID(pool.PoolGUID, "mirror-2_redundancy")].payload())
+	assert.Equal(t, []byte("1"), byUID[zpoolSensorUID(pool.PoolGUID, "mirror-0_redundancy")].payload(), "Expected spare to replace the faulted disk")
+	assert.NotContains(t, byUID, zpoolSensorUID(pool.PoolGUID, "mirror-1_redundancy"), "Expected log vdevs to be skipped")
+}
@@ -0,0 +1,114 @@
+package zpool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// decodeErrorList accepts the permanent errors either as a list or as an object keyed by file or object name.
+func decodeErrorList(raw json.RawMessage) ([]string, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return nil, false
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		return list, true
+	}
+	var byName map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &byName); err != nil {
+		return nil, false
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, true
+}
+
+// parseErrorText reads the file list below "errors: Permanent errors have been detected" of `zpool status -v`.
+func parseErrorText(out []byte) []string {
+	var files []string
+	inList := false
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(trimmed, "errors: Permanent errors"):
+			inList = true
+		case !inList || trimmed == "":
+			continue
+		case line[0] != ' ' && line[0] != '\t':
+			inList = false
+		default:
+			files = append(files, trimmed)
+		}
+	}
+	return files
+}
+
+// runErrorList returns the files and objects with permanent errors in a pool.
+// Falls back to the text output if the JSON output does not list them.
+func runErrorList(ctx context.Context, exec func(context.Context, string, ...string) zpoolExecutor, pool string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, err := exec(ctx, "zpool", "status", "-v", "-j", pool).Output()
+	if err == nil {
+		var status zpoolErrorStatus
+		if err := json.Unmarshal(out, &status); err == nil {
+			if files, ok := decodeErrorList(status.Pools[pool].Errors); ok {
+				return files, nil
+			}
+		}
+	}
+	out, err = exec(ctx, "zpool", "status", "-v", pool).Output()
+	if err != nil {
+		return nil, err
+	}
+	return parseErrorText(out), nil
+}
+
+// buildDataErrorEntries constructs the data errors problem sensor, listing the affected files up to the configured limit.
+// The sensor is still published if the file list cannot be read, with the reason as attribute.
+func (p *ZpoolProvider) buildDataErrorEntries(ctx context.Context, pool *zpoolPool) []zpoolSensorEntry {
+	var (
+		files   []string
+		listErr error
+	)
+	if pool.ErrorCount > 0 {
+		files, listErr = runErrorList(ctx, p.execFn, pool.Name)
+	}
+	total := len(files)
+	truncated := total > p.config.DataErrorsLimit
+	if truncated {
+		files = files[:p.config.DataErrorsLimit]
+	}
+
+	uid := zpoolSensorUID(pool.PoolGUID, "data_errors")
+	cfg := makeSensorConfig("Data errors", uid, "binary_sensor", "problem", "", "", zpoolDevice(pool), p.interval)
+	cfg.JsonAttributesTopic = zpoolAttrTopic("binary_sensor", uid)
+	return []zpoolSensorEntry{{
+		config:  cfg,
+		domain:  "binary_sensor",
+		payload: func() []byte { return mqttclient.ProblemPayload(pool.ErrorCount == 0) },
+		attrs: func() ([]byte, error) {
+			m := map[string]any{
+				"files":     files,
+				"total":     total,
+				"truncated": truncated,
+			}
+			if listErr != nil {
+				m["error"] = listErr.Error()
+			}
+			return json.Marshal(m)
+		},
+	}}
+}
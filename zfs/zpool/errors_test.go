@@ -0,0 +1,103 @@
+package zpool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+const errorText = `  pool: tank
+ state: ONLINE
+status: One or more devices has experienced an error resulting in data
+	corruption.  Applications may be affected.
+config:
+
+	NAME        STATE     READ WRITE CKSUM
+	tank        ONLINE       0     0     0
+	  sda       ONLINE       0     0     2
+
+errors: Permanent errors have been detected in the following files:
+
+        /tank/photos/2024/img_0042.jpg
+        tank/vm:<0x1f3>
+        <metadata>:<0x0>
+`
+
+func TestParseErrorText(t *testing.T) {
+	files := parseErrorText([]byte(errorText))
+	assert.Equal(t, []string{"/tank/photos/2024/img_0042.jpg", "tank/vm:<0x1f3>", "<metadata>:<0x0>"}, files)
+	assert.Empty(t, parseErrorText([]byte("errors: No known data errors\n")))
+}
+
+func TestDecodeErrorList(t *testing.T) {
+	files, ok := decodeErrorList(json.RawMessage(`["/tank/a", "/tank/b"]`))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"/tank/a", "/tank/b"}, files)
+
+	files, ok = decodeErrorList(json.RawMessage(`{"/tank/b": {}, "/tank/a": {}}`))
+	assert.True(t, ok)
+	assert.Equal(t, []string{"/tank/a", "/tank/b"}, files)
+
+	_, ok = decodeErrorList(nil)
+	assert.False(t, ok)
+}
+
+// errorListExec serves the pool status fixture and the text output of `zpool status -v`.
+func errorListExec(t *testing.T) func(context.Context, string, ...string) zpoolExecutor {
+	t.Helper()
+	status, err := os.ReadFile("zoolstatus3.json")
+	require.NoError(t, err)
+	return func(_ context.Context, _ string, arg ...string) zpoolExecutor {
+		switch {
+		case slices.Contains(arg, "-v") && slices.Contains(arg, "-j"):
+			return &mockZpoolCmd{data: []byte(`{"pools": {"tank": {"name": "tank"}}}`)}
+		case slices.Contains(arg, "-v"):
+			return &mockZpoolCmd{data: []byte(errorText)}
+		default:
+			return &mockZpoolCmd{data: status}
+		}
+	}
+}
+
+func TestDataErrorEntriesTextFallback(t *testing.T) {
+	config := models.ZFSdefault().Zpool
+	config.DataErrorsLimit = 2
+	provider := NewZpoolProvider(config, "", 20*time.Minute)
+	provider.execFn = errorListExec(t)
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+
+	var dataErrors *models.Entry
+	for _, e := range entries {
+		if e.Config.UniqueID == zpoolSensorUID(5558451263911426331, "data_errors") {
+			dataErrors = &e
+		}
+	}
+	require.NotNil(t, dataErrors)
+	assert.Equal(t, []byte("ON"), dataErrors.Payload)
+	var attrMap map[string]any
+	require.NoError(t, json.Unmarshal(dataErrors.Attributes, &attrMap))
+	assert.Equal(t, []any{"/tank/photos/2024/img_0042.jpg", "tank/vm:<0x1f3>"}, attrMap["files"])
+	assert.Equal(t, 3.0, attrMap["total"])
+	assert.Equal(t, true, attrMap["truncated"])
+}
+
+func TestDataErrorEntriesNoErrors(t *testing.T) {
+	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus.json"))
+	require.NoError(t, err)
+	provider := NewZpoolProvider(models.ZFSdefault().Zpool, "", 20*time.Minute)
+	provider.execFn = func(_ context.Context, _ string, _ ...string) zpoolExecutor {
+		t.Fatal("Expected no error listing for a pool without errors")
+		return nil
+	}
+	entries := provider.buildDataErrorEntries(context.Background(), status.Pools["data"])
+	require.Len(t, entries, 1)
+	assert.Equal(t, []byte("OFF"), entries[0].payload())
+}
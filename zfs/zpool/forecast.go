@@ -0,0 +1,172 @@
+package zpool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// Minimum time between two samples, so refreshes after events do not skew the history
+	historyInterval = time.Hour
+	// Minimum time span of the history before a trend is fitted
+	minForecastSpan = 24 * time.Hour
+	// ETAs further out than this are no forecast but noise of a nearly static pool
+	forecastHorizon = 10 * 365 * 24 * time.Hour
+)
+
+// newAllocHistory returns a history that is kept in a file of the state directory, or only in memory if the directory is empty.
+func newAllocHistory(stateDir string, days int) *allocHistory {
+	h := &allocHistory{window: time.Duration(days) * 24 * time.Hour, samples: map[uint64][]allocSample{}}
+	if stateDir != "" {
+		h.path = filepath.Join(stateDir, "zpool_history.json")
+	}
+	return h
+}
+
+// load reads the history file once. A missing file is an empty history.
+func (h *allocHistory) load() error {
+	if h.loaded || h.path == "" {
+		return nil
+	}
+	h.loaded = true
+	data, err := os.ReadFile(h.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &h.samples)
+}
+
+// add records the allocated space of a pool, unless the last sample is recent, and drops samples outside the window.
+// Returns true if the history changed.
+func (h *allocHistory) add(guid uint64, now time.Time, alloc int64) bool {
+	samples := h.samples[guid]
+	if n := len(samples); n > 0 && now.Sub(samples[n-1].Time) < historyInterval {
+		return false
+	}
+	samples = append(samples, allocSample{Time: now, Alloc: alloc})
+	start := 0
+	for start < len(samples) && now.Sub(samples[start].Time) > h.window {
+		start++
+	}
+	h.samples[guid] = samples[start:]
+	return true
+}
+
+// save writes the history file atomically.
+func (h *allocHistory) save() error {
+	if h.path == "" {
+		return nil
+	}
+	data, err := json.Marshal(h.samples)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	tmp := h.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, h.path)
+}
+
+// fitGrowth fits a linear trend to the samples by least squares and returns the growth in bytes per day.
+// Returns false if the samples span less than a day.
+func fitGrowth(samples []allocSample) (float64, bool) {
+	if len(samples) < 2 || samples[len(samples)-1].Time.Sub(samples[0].Time) < minForecastSpan {
+		return 0, false
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.Time.Sub(samples[0].Time).Hours() / 24
+		y := float64(s.Alloc)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	return (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX), true
+}
+
+// forecastETA returns when the allocated space reaches a fraction of the total at the given growth,
+// or false if it does not grow fast enough to get there within the forecast horizon.
+// A pool that is already there gets the current time.
+func forecastETA(alloc, total int64, fraction, growth float64, now time.Time) (time.Time, bool) {
+	remaining := fraction*float64(total) - float64(alloc)
+	if remaining <= 0 {
+		return now, true
+	}
+	if growth <= 0 {
+		return time.Time{}, false
+	}
+	// Compared in days before the conversion, as a tiny growth overflows time.Duration
+	days := remaining / growth
+	if days > forecastHorizon.Hours()/24 {
+		return time.Time{}, false
+	}
+	return now.Add(time.Duration(days * float64(24*time.Hour))), true
+}
+
+// buildForecastEntries records the allocated space of a pool and constructs the growth rate and time until full sensors.
+func (p *ZpoolProvider) buildForecastEntries(pool *zpoolPool, now time.Time) []zpoolSensorEntry {
+	rootVdev := pool.Vdevs[pool.Name]
+	if rootVdev == nil {
+		return nil
+	}
+	guid := pool.PoolGUID
+	device := zpoolDevice(pool)
+	if p.history.add(guid, now, rootVdev.AllocSpace) {
+		p.changed = true
+	}
+	samples := p.history.samples[guid]
+	growth, ok := fitGrowth(samples)
+
+	growthUID := zpoolSensorUID(guid, "growth_rate")
+	growthCfg := makeSensorConfig("Growth rate", growthUID, "sensor", "", "measurement", "GiB/d", device, p.interval)
+	growthCfg.JsonAttributesTopic = zpoolAttrTopic("sensor", growthUID)
+	entries := []zpoolSensorEntry{{
+		config: growthCfg,
+		domain: "sensor",
+		payload: func() []byte {
+			if !ok {
+				return payloadNone
+			}
+			return []byte(fmt.Sprintf("%.2f", growth/gib))
+		},
+		attrs: func() ([]byte, error) {
+			span := samples[len(samples)-1].Time.Sub(samples[0].Time)
+			return json.Marshal(map[string]any{"samples": len(samples), "days": fmt.Sprintf("%.1f", span.Hours()/24)})
+		},
+	}}
+	for _, f := range []struct {
+		suffix   string
+		name     string
+		fraction float64
+	}{
+		{"eta_warning", fmt.Sprintf("Estimated %d%% full", p.config.ForecastWarnPercent), float64(p.config.ForecastWarnPercent) / 100},
+		{"eta_full", "Estimated full", 1},
+	} {
+		eta, etaOK := forecastETA(rootVdev.AllocSpace, rootVdev.TotalSpace, f.fraction, growth, now)
+		entries = append(entries, zpoolSensorEntry{
+			config: makeSensorConfig(f.name, zpoolSensorUID(guid, f.suffix), "sensor", "timestamp", "", "", device, p.interval),
+			domain: "sensor",
+			payload: func() []byte {
+				if !ok || !etaOK {
+					return payloadNone
+				}
+				return []byte(eta.UTC().Format(time.RFC3339))
+			},
+		})
+	}
+	return entries
+}
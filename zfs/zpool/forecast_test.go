@@ -0,0 +1,92 @@
+package zpool
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func TestFitGrowth(t *testing.T) {
+	start := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	var samples []allocSample
+	for day := range 10 {
+		samples = append(samples, allocSample{Time: start.Add(time.Duration(day) * 24 * time.Hour), Alloc: int64(100+2*day) << 30})
+	}
+	growth, ok := fitGrowth(samples)
+	require.True(t, ok)
+	assert.InDelta(t, 2*gib, growth, 1)
+
+	_, ok = fitGrowth(samples[:1])
+	assert.False(t, ok)
+	_, ok = fitGrowth([]allocSample{{Time: start}, {Time: start.Add(time.Hour), Alloc: 1 << 30}})
+	assert.False(t, ok, "Expected no trend from less than a day of samples")
+}
+
+func TestForecastETA(t *testing.T) {
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+	eta, ok := forecastETA(600<<30, 1000<<30, 0.8, 10*gib, now)
+	require.True(t, ok)
+	assert.Equal(t, now.Add(20*24*time.Hour), eta)
+
+	eta, ok = forecastETA(900<<30, 1000<<30, 0.8, 10*gib, now)
+	require.True(t, ok)
+	assert.Equal(t, now, eta, "Expected a pool past the threshold to be there now")
+
+	_, ok = forecastETA(600<<30, 1000<<30, 1, -1*gib, now)
+	assert.False(t, ok, "Expected no ETA for a shrinking pool")
+
+	// 400 GiB at about a byte per day is beyond the horizon, and beyond what time.Duration holds
+	_, ok = forecastETA(600<<30, 1000<<30, 1, 1.2, now)
+	assert.False(t, ok, "Expected no ETA for a nearly static pool")
+	eta, ok = forecastETA(600<<30, 1000<<30, 1, 400*gib/(5*365), now)
+	require.True(t, ok)
+	assert.True(t, eta.After(now), "Expected an ETA within the horizon to be in the future")
+}
+
+func TestAllocHistory(t *testing.T) {
+	dir := t.TempDir()
+	history := newAllocHistory(dir, 2)
+	require.NoError(t, history.load())
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	assert.True(t, history.add(1, now.Add(-72*time.Hour), 10))
+	assert.True(t, history.add(1, now.Add(-24*time.Hour), 20))
+	assert.False(t, history.add(1, now.Add(-23*time.Hour-30*time.Minute), 21), "Expected samples within the interval to be skipped")
+	assert.True(t, history.add(1, now, 30))
+	assert.Equal(t, []int64{20, 30}, []int64{history.samples[1][0].Alloc, history.samples[1][1].Alloc}, "Expected samples outside the window to be dropped")
+	require.NoError(t, history.save())
+
+	reloaded := newAllocHistory(dir, 2)
+	require.NoError(t, reloaded.load())
+	assert.Equal(t, history.samples, reloaded.samples)
+}
+
+func TestForecastEntries(t *testing.T) {
+	provider := NewZpoolProvider(models.ZFSdefault().Zpool, "", 20*time.Minute)
+	pool := &zpoolPool{Name: "tank", PoolGUID: 7, Vdevs: map[string]*vdev{"tank": {Name: "tank", AllocSpace: 500 << 30, TotalSpace: 1000 << 30}}}
+	now := time.Date(2026, 10, 18, 0, 0, 0, 0, time.UTC)
+
+	entries, err := toEntries(provider.buildForecastEntries(pool, now))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, payloadNone, entries[0].Payload, "Expected no trend from the first sample")
+	assert.Equal(t, payloadNone, entries[2].Payload)
+	assert.True(t, provider.changed)
+
+	pool.Vdevs["tank"].AllocSpace = 510 << 30
+	entries, err = toEntries(provider.buildForecastEntries(pool, now.Add(48*time.Hour)))
+	require.NoError(t, err)
+	assert.Equal(t, zpoolSensorUID(7, "growth_rate"), entries[0].Config.UniqueID)
+	assert.Equal(t, "GiB/d", entries[0].Config.UnitOfMeasurement)
+	assert.Equal(t, []byte("5.00"), entries[0].Payload)
+	var attrs map[string]any
+	require.NoError(t, json.Unmarshal(entries[0].Attributes, &attrs))
+	assert.Equal(t, float64(2), attrs["samples"])
+	// 290 GiB to 80% and 490 GiB to full at 5 GiB per day
+	assert.Equal(t, "Estimated 80% full", entries[1].Config.Name)
+	assert.Equal(t, []byte("2026-12-17T00:00:00Z"), entries[1].Payload)
+	assert.Equal(t, []byte("2027-01-26T00:00:00Z"), entries[2].Payload)
+}
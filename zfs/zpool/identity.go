@@ -0,0 +1,73 @@
+package zpool
+
+import (
+	"github.com/ykgmfq/SystemPub/zfs/disk"
+)
+
+// Block devices and identities of the physical disks of a pool by leaf vdev name, and the configured bay labels by serial number
+type poolDisks struct {
+	devices    map[string]string
+	identities map[string]disk.Identity
+	bays       map[string]string
+}
+
+// lookupDisks resolves the leaf vdevs of a pool to their physical disks.
+// Leaves that cannot be resolved, like file vdevs or disks that are gone, are left out.
+func lookupDisks(resolver disk.Resolver, pool *zpoolPool, bays map[string]string) poolDisks {
+	disks := poolDisks{devices: map[string]string{}, identities: map[string]disk.Identity{}, bays: bays}
+	for _, leaf := range poolLeaves(pool) {
+		if leaf.vdev.VdevType != "disk" || leaf.vdev.Path == "" {
+			continue
+		}
+		blockDev, err := resolver.BlockDevice(leaf.vdev.Path)
+		if err != nil {
+			Logger.Debug().Str("mod", "zpool").Str("vdev", leaf.vdev.Name).Err(err).Msg("Could not resolve block device")
+			continue
+		}
+		disks.devices[leaf.vdev.Name] = blockDev
+		id, err := resolver.Identity(blockDev)
+		if err != nil {
+			Logger.Debug().Str("mod", "zpool").Str("vdev", leaf.vdev.Name).Err(err).Msg("Could not read disk identity")
+			continue
+		}
+		disks.identities[leaf.vdev.Name] = id
+	}
+	return disks
+}
+
+// bayLabel returns the name of a leaf vdev in entity names: the bay label configured for the disk serial, or the vdev name.
+func bayLabel(bays map[string]string, serial, name, className string) string {
+	if bay, ok := bays[serial]; ok && serial != "" {
+		return className + bay
+	}
+	return className + name
+}
+
+// label returns the name of a leaf vdev in entity names.
+func (d poolDisks) label(leaf *vdev, className string) string {
+	return bayLabel(d.bays, d.identities[leaf.Name].Serial, leaf.Name, className)
+}
+
+// addIdentity adds the identity of the disk behind a leaf vdev to its attributes.
+func (d poolDisks) addIdentity(leaf *vdev, m map[string]any) {
+	id, ok := d.identities[leaf.Name]
+	if !ok {
+		return
+	}
+	for key, val := range map[string]string{
+		"model":     id.Model,
+		"serial":    id.Serial,
+		"wwn":       id.WWN,
+		"enclosure": id.Enclosure,
+		"slot":      id.Slot,
+	} {
+		if val != "" {
+			m[key] = val
+		}
+	}
+	if bay, ok := d.bays[id.Serial]; ok && id.Serial != "" {
+		m["bay"] = bay
+	}
+	m["size"] = id.Size
+	m["rotational"] = id.Rotational
+}
@@ -0,0 +1,58 @@
+package zpool
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/zfs/disk"
+)
+
+func TestDiskEntriesIdentity(t *testing.T) {
+	leaf := &vdev{Name: "sda1", VdevType: "disk", State: "ONLINE", Path: "/dev/sda1"}
+	disks := poolDisks{
+		identities: map[string]disk.Identity{"sda1": {
+			Model:      "WDC WD40EFRX-68N",
+			Serial:     "WD-WCC7K0000001",
+			WWN:        "0x50014ee2b0000001",
+			Size:       4000787030016,
+			Rotational: true,
+			Enclosure:  "0:0:8:0",
+			Slot:       "1",
+		}},
+		bays: map[string]string{"WD-WCC7K0000001": "Bay 3"},
+	}
+	pool := &zpoolPool{Name: "tank", PoolGUID: 1}
+	entries := buildDiskEntries(leaf, "log_", "Log ", disks, zpoolDevice(pool), pool.PoolGUID, 20*time.Minute)
+
+	health := entries[0]
+	assert.Equal(t, "Log Bay 3 health", health.config.Name)
+	assert.Equal(t, zpoolSensorUID(1, "log_sda1_health"), health.config.UniqueID, "Expected the bay label not to change the unique ID")
+	attrs, err := health.attrs()
+	require.NoError(t, err)
+	var attrMap map[string]any
+	require.NoError(t, json.Unmarshal(attrs, &attrMap))
+	assert.Equal(t, "WD-WCC7K0000001", attrMap["serial"])
+	assert.Equal(t, "0x50014ee2b0000001", attrMap["wwn"])
+	assert.Equal(t, "1", attrMap["slot"])
+	assert.Equal(t, "Bay 3", attrMap["bay"])
+	assert.Equal(t, true, attrMap["rotational"])
+	assert.Equal(t, float64(4000787030016), attrMap["size"])
+	assert.Equal(t, "Log Bay 3 read errors", entries[1].config.Name)
+
+	// Without an identity, names and attributes stay as before
+	entries = buildDiskEntries(leaf, "", "", poolDisks{}, zpoolDevice(pool), pool.PoolGUID, 20*time.Minute)
+	assert.Equal(t, "sda1 health", entries[0].config.Name)
+	attrs, err = entries[0].attrs()
+	require.NoError(t, err)
+	assert.NotContains(t, string(attrs), "serial")
+}
+
+func TestBayLabel(t *testing.T) {
+	bays := map[string]string{"S5GXNX0T000001": "Front M.2"}
+	assert.Equal(t, "Special Front M.2", bayLabel(bays, "S5GXNX0T000001", "nvme0n1p2", "Special "))
+	assert.Equal(t, "sdb", bayLabel(bays, "WD-OTHER", "sdb", ""))
+	assert.Equal(t, "sdb", bayLabel(map[string]string{"": "Empty"}, "", "sdb", ""), "Expected an unknown serial not to match")
+}
@@ -0,0 +1,194 @@
+package zpool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// runIostat samples `zpool iostat` once over the window, so the rates are not averaged since boot.
+// The output arrives at the end of the window.
+func runIostat(ctx context.Context, exec func(context.Context, string, ...string) zpoolExecutor, window time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, window+3*time.Second)
+	defer cancel()
+	seconds := strconv.Itoa(max(1, int(window.Seconds())))
+	return exec(ctx, "zpool", "iostat", "-y", "-H", "-p", "-l", "-v", seconds, "1").Output()
+}
+
+// parseIostatValue parses an exact value of scripted `zpool iostat`, where "-" means not available.
+func parseIostatValue(field string) float64 {
+	value, err := strconv.ParseFloat(field, 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// parseIostat maps the lines of scripted `zpool iostat -v` to pools and their top-level vdevs.
+// Scripted output is not indented, so the hierarchy is taken from the pool status.
+// The pool line itself is stored under the pool name.
+func parseIostat(out []byte, status *zpoolStatus) map[string]map[string]iostatLine {
+	result := make(map[string]map[string]iostatLine)
+	var pool *zpoolPool
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		// name, alloc, free, read/write ops, read/write bandwidth, read/write total wait
+		if len(fields) < 9 {
+			continue
+		}
+		name := fields[0]
+		if p, ok := status.Pools[name]; ok {
+			pool = p
+			result[name] = make(map[string]iostatLine)
+		} else if pool == nil || !isTopLevelVdev(pool, name) {
+			continue
+		}
+		result[pool.Name][name] = iostatLine{
+			ReadOps:    parseIostatValue(fields[3]),
+			WriteOps:   parseIostatValue(fields[4]),
+			ReadBytes:  parseIostatValue(fields[5]),
+			WriteBytes: parseIostatValue(fields[6]),
+			ReadWait:   parseIostatValue(fields[7]),
+			WriteWait:  parseIostatValue(fields[8]),
+		}
+	}
+	return result
+}
+
+// isTopLevelVdev reports whether name is a direct child of the pool's root vdev.
+func isTopLevelVdev(pool *zpoolPool, name string) bool {
+	root := pool.Vdevs[pool.Name]
+	if root == nil {
+		return false
+	}
+	for _, child := range root.Vdevs {
+		if child.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// iostatNames returns the pool name followed by the names of its top-level vdevs.
+func iostatNames(pool *zpoolPool) []string {
+	names := []string{pool.Name}
+	if root := pool.Vdevs[pool.Name]; root != nil {
+		for _, child := range root.Vdevs {
+			names = append(names, child.Name)
+		}
+	}
+	return names
+}
+
+// buildIostatEntries constructs the throughput and latency sensors for the pool or one of its top-level vdevs.
+// Without a sample yet, line is nil and the sensors are unknown.
+func buildIostatEntries(pool *zpoolPool, name string, line *iostatLine, interval time.Duration) []zpoolSensorEntry {
+	device := zpoolDevice(pool)
+	key, prefix := "iostat", "Pool "
+	if name != pool.Name {
+		key, prefix = mqttclient.NormalizeStr(name), name+" "
+	}
+	sampled := line != nil
+	if !sampled {
+		line = &iostatLine{}
+	}
+	sensors := []struct {
+		suffix      string
+		name        string
+		deviceClass string
+		unit        string
+		val         float64
+	}{
+		{"_read_ops", "read operations", "", "ops/s", line.ReadOps},
+		{"_write_ops", "write operations", "", "ops/s", line.WriteOps},
+		{"_read_bandwidth", "read bandwidth", "data_rate", "MiB/s", line.ReadBytes / mib},
+		{"_write_bandwidth", "write bandwidth", "data_rate", "MiB/s", line.WriteBytes / mib},
+		{"_read_wait", "read wait", "duration", "ms", line.ReadWait / float64(time.Millisecond)},
+		{"_write_wait", "write wait", "duration", "ms", line.WriteWait / float64(time.Millisecond)},
+	}
+	entries := make([]zpoolSensorEntry, 0, len(sensors))
+	for _, s := range sensors {
+		uid := zpoolSensorUID(pool.PoolGUID, key+s.suffix)
+		entries = append(entries, zpoolSensorEntry{
+			config: makeSensorConfig(prefix+s.name, uid, "sensor", s.deviceClass, "measurement", s.unit, device, interval),
+			domain: "sensor",
+			payload: func() []byte {
+				if !sampled {
+					return payloadNone
+				}
+				return []byte(fmt.Sprintf("%.2f", s.val))
+			},
+		})
+	}
+	return entries
+}
+
+// NewIostatProvider returns a provider that samples `zpool iostat` over the refresh interval.
+func NewIostatProvider(interval time.Duration) *IostatProvider {
+	return &IostatProvider{
+		interval:   interval,
+		retryDelay: time.Minute,
+		execFn: func(ctx context.Context, name string, arg ...string) zpoolExecutor {
+			return exec.CommandContext(ctx, name, arg...)
+		},
+	}
+}
+
+// Watch is a long-running routine that samples `zpool iostat` back to back, each sample covering one refresh interval, and keeps the last one for Entries.
+// The samples are not sent as entries, as entries of watchers trigger a refresh of all providers.
+func (p *IostatProvider) Watch(ctx context.Context, _ chan<- models.Entry) {
+	for ctx.Err() == nil {
+		out, err := runIostat(ctx, p.execFn, p.interval)
+		if err == nil {
+			p.mu.Lock()
+			p.last = out
+			p.mu.Unlock()
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		Logger.Warn().Str("mod", "zpool").Err(err).Msg("Could not sample zpool iostat")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(p.retryDelay):
+		}
+	}
+}
+
+// Entries returns sensor entries for all pools and top-level vdevs from the last `zpool iostat` sample, which covers the last full interval.
+// The sensors are unknown until the first sample is done, one interval after the start.
+func (p *IostatProvider) Entries(ctx context.Context) ([]models.Entry, error) {
+	status, err := runZpool(ctx, p.execFn)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	lines := parseIostat(p.last, status)
+	p.mu.Unlock()
+	var entries []models.Entry
+	for _, pool := range status.Pools {
+		for _, name := range iostatNames(pool) {
+			var line *iostatLine
+			if l, ok := lines[pool.Name][name]; ok {
+				line = &l
+			}
+			converted, err := toEntries(buildIostatEntries(pool, name, line, p.interval))
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, converted...)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,82 @@
+package zpool
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func iostatFixtureExec(t *testing.T) func(context.Context, string, ...string) zpoolExecutor {
+	t.Helper()
+	status, err := os.ReadFile("zoolstatus2.json")
+	require.NoError(t, err)
+	iostat, err := os.ReadFile("zpooliostat.txt")
+	require.NoError(t, err)
+	return func(_ context.Context, _ string, arg ...string) zpoolExecutor {
+		if arg[0] == "iostat" {
+			return &mockZpoolCmd{data: iostat}
+		}
+		return &mockZpoolCmd{data: status}
+	}
+}
+
+func TestParseIostat(t *testing.T) {
+	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus2.json"))
+	require.NoError(t, err)
+	out, err := os.ReadFile("zpooliostat.txt")
+	require.NoError(t, err)
+
+	result := parseIostat(out, status)
+	require.Len(t, result, 2)
+	assert.Len(t, result["test"], 2, "Expected pool and top-level vdev, but no leaves")
+	assert.Equal(t, iostatLine{ReadOps: 2, WriteOps: 5, ReadBytes: 8192, WriteBytes: 409600, ReadWait: 120000, WriteWait: 2500000}, result["test"]["mirror-0"])
+	assert.Equal(t, iostatLine{}, result["test2"]["mirror-0"], "Expected unavailable latencies to be zero")
+}
+
+func TestIostatEntries(t *testing.T) {
+	provider := NewIostatProvider(20 * time.Minute)
+	fixtureExec := iostatFixtureExec(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	samples := 0
+	provider.execFn = func(ctx context.Context, name string, arg ...string) zpoolExecutor {
+		if arg[0] == "iostat" {
+			assert.Equal(t, []string{"1200", "1"}, arg[len(arg)-2:], "Expected one sample over the refresh interval")
+			if samples++; samples > 1 {
+				cancel()
+				return &mockZpoolCmd{err: ctx.Err()}
+			}
+		}
+		return fixtureExec(ctx, name, arg...)
+	}
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, entries, 24, "Expected the sensors to be discovered before the first sample")
+	for _, e := range entries {
+		assert.Equal(t, []byte("None"), e.Payload)
+	}
+
+	// Samples are taken back to back until the context ends
+	provider.Watch(ctx, nil)
+	assert.Equal(t, 2, samples)
+	entries, err = provider.Entries(context.Background())
+	require.NoError(t, err)
+	assert.Len(t, entries, 24)
+
+	byUID := map[string]models.Entry{}
+	for _, e := range entries {
+		byUID[e.Config.UniqueID] = e
+	}
+	guid := uint64(13597808324366013145)
+	wait := byUID[zpoolSensorUID(guid, "iostat_write_wait")]
+	assert.Equal(t, "Pool write wait", wait.Config.Name)
+	assert.Equal(t, "ms", wait.Config.UnitOfMeasurement)
+	assert.Equal(t, []byte("2.50"), wait.Payload)
+	bandwidth := byUID[zpoolSensorUID(guid, "mirror-0_write_bandwidth")]
+	assert.Equal(t, "mirror-0 write bandwidth", bandwidth.Config.Name)
+	assert.Equal(t, []byte("0.39"), bandwidth.Payload)
+}
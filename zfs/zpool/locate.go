@@ -0,0 +1,92 @@
+package zpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+	"github.com/ykgmfq/SystemPub/zfs/disk"
+)
+
+// NewLocateProvider returns a provider for the enclosure locate LEDs of pool disks.
+// It writes to sysfs on commands from Home Assistant, so it is only used if hardware actions are allowed.
+func NewLocateProvider(config models.Zpool, interval time.Duration) *LocateProvider {
+	return &LocateProvider{
+		interval: interval,
+		execFn: func(ctx context.Context, name string, arg ...string) zpoolExecutor {
+			return exec.CommandContext(ctx, name, arg...)
+		},
+		disks:   disk.NewResolver(),
+		bays:    config.Bays,
+		targets: make(map[string]string),
+	}
+}
+
+// buildLocateEntry constructs the locate LED switch of one disk.
+func buildLocateEntry(pool *zpoolPool, leaf poolLeaf, disks poolDisks, on bool, interval time.Duration) zpoolSensorEntry {
+	uid := zpoolSensorUID(pool.PoolGUID, leaf.classKey+mqttclient.NormalizeStr(leaf.vdev.Name)+"_locate")
+	cfg := makeSensorConfig(disks.label(leaf.vdev, leaf.className)+" locate LED", uid, "switch", "", "", "", zpoolDevice(pool), interval)
+	// Switches neither expire nor force updates
+	cfg.ExpireAfter = 0
+	cfg.ForceUpdate = false
+	cfg.CommandTopic = mqttclient.CommandTopic("switch", uid)
+	return zpoolSensorEntry{
+		config:  cfg,
+		domain:  "switch",
+		payload: func() []byte { return mqttclient.BinaryPayload(on) },
+	}
+}
+
+// Entries returns a locate LED switch for every pool disk in an enclosure slot, with the current LED state.
+func (p *LocateProvider) Entries(ctx context.Context) ([]models.Entry, error) {
+	status, err := runZpool(ctx, p.execFn)
+	if err != nil {
+		return nil, err
+	}
+	targets := map[string]string{}
+	var sensors []zpoolSensorEntry
+	for _, pool := range status.Pools {
+		disks := lookupDisks(p.disks, pool, p.bays)
+		for _, leaf := range poolLeaves(pool) {
+			blockDev, ok := disks.devices[leaf.vdev.Name]
+			if !ok {
+				continue
+			}
+			on, err := p.disks.Locate(blockDev)
+			if errors.Is(err, disk.ErrNoSlot) {
+				continue
+			}
+			if err != nil {
+				Logger.Warn().Str("mod", "zpool").Str("vdev", leaf.vdev.Name).Err(err).Msg("Could not read locate LED")
+				continue
+			}
+			entry := buildLocateEntry(pool, leaf, disks, on, p.interval)
+			targets[entry.config.CommandTopic] = blockDev
+			sensors = append(sensors, entry)
+		}
+	}
+	p.targets = targets
+	return toEntries(sensors)
+}
+
+// Command switches the locate LED of a disk on "ON" or "OFF" on its command topic.
+func (p *LocateProvider) Command(_ context.Context, topic string, payload []byte) (bool, error) {
+	blockDev, ok := p.targets[topic]
+	if !ok {
+		return false, nil
+	}
+	var on bool
+	switch string(payload) {
+	case "ON":
+		on = true
+	case "OFF":
+	default:
+		return true, fmt.Errorf("invalid locate LED command %q", payload)
+	}
+	Logger.Info().Str("mod", "zpool").Str("device", blockDev).Bool("on", on).Msg("Switching locate LED")
+	return true, p.disks.SetLocate(blockDev, on)
+}
@@ -0,0 +1,74 @@
+package zpool
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/zfs/disk"
+)
+
+// enclosureRoot builds a fake /dev and /sys tree with /dev/sda1 on a disk in enclosure slot 1.
+func enclosureRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	scsi := filepath.Join(root, "sys/devices/host0/target0:0:0/0:0:0:0")
+	block := filepath.Join(scsi, "block/sda")
+	slot := filepath.Join(root, "sys/class/enclosure/0:0:8:0/Slot 01")
+	for _, dir := range []string{filepath.Join(root, "dev"), filepath.Join(block, "sda1"), filepath.Join(root, "sys/class/block"), filepath.Join(root, "sys/block"), slot} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+	}
+	for path, content := range map[string]string{
+		"dev/sda1": "",
+		"sys/devices/host0/target0:0:0/0:0:0:0/block/sda/sda1/partition": "1\n",
+		"sys/class/enclosure/0:0:8:0/Slot 01/locate":                     "0\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, path), []byte(content), 0644))
+	}
+	for link, target := range map[string]string{
+		"sys/class/block/sda1":                                   filepath.Join(block, "sda1"),
+		"sys/block/sda":                                          block,
+		"sys/class/enclosure/0:0:8:0/Slot 01/device":             scsi,
+		"sys/devices/host0/target0:0:0/0:0:0:0/block/sda/device": scsi,
+	} {
+		require.NoError(t, os.Symlink(target, filepath.Join(root, link)))
+	}
+	return root
+}
+
+func TestLocateProvider(t *testing.T) {
+	root := enclosureRoot(t)
+	provider := NewLocateProvider(models.Zpool{}, 20*time.Minute)
+	provider.execFn = zpoolFixtureExec(t, "zoolstatus3.json")
+	provider.disks = disk.Resolver{Root: root}
+
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "Expected a switch only for the disk in an enclosure slot")
+	led := entries[0]
+	assert.Equal(t, "switch", led.Domain)
+	assert.Equal(t, "sda locate LED", led.Config.Name)
+	assert.Equal(t, "homeassistant/switch/zpool_5558451263911426331_sda_locate/set", led.Config.CommandTopic)
+	assert.Zero(t, led.Config.ExpireAfter)
+	assert.Equal(t, []byte("OFF"), led.Payload)
+
+	handled, err := provider.Command(context.Background(), led.Config.CommandTopic, []byte("ON"))
+	require.NoError(t, err)
+	assert.True(t, handled)
+	content, err := os.ReadFile(filepath.Join(root, "sys/class/enclosure/0:0:8:0/Slot 01/locate"))
+	require.NoError(t, err)
+	assert.Equal(t, "1", string(content))
+
+	handled, err = provider.Command(context.Background(), led.Config.CommandTopic, []byte("BLINK"))
+	assert.True(t, handled)
+	assert.Error(t, err)
+
+	handled, err = provider.Command(context.Background(), "homeassistant/switch/other/set", []byte("ON"))
+	require.NoError(t, err)
+	assert.False(t, handled, "Expected commands for other entities to be left to other providers")
+}
@@ -2,9 +2,12 @@ package zpool
 
 import (
 	"context"
+	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/zfs/disk"
 )
 
 type zpoolExecutor interface {
@@ -14,16 +17,34 @@ type zpoolExecutor interface {
 // JSON structs for `zpool status -j --json-int`
 
 type scanStats struct {
-	Function  string `json:"function"`
-	State     string `json:"state"`
-	StartTime int64  `json:"start_time"`
-	EndTime   int64  `json:"end_time"`
-	Errors    int    `json:"errors"`
+	Function         string `json:"function"`
+	State            string `json:"state"`
+	StartTime        int64  `json:"start_time"`
+	EndTime          int64  `json:"end_time"`
+	ToExamine        int64  `json:"to_examine"`
+	Examined         int64  `json:"examined"`
+	Skipped          int64  `json:"skipped"`
+	Issued           int64  `json:"issued"`
+	PassIssued       int64  `json:"issued_bytes_per_scan"`
+	PassStart        int64  `json:"pass_start"`
+	ScrubPause       int64  `json:"scrub_pause"`
+	ScrubSpentPaused int64  `json:"scrub_spent_paused"`
+	Errors           int    `json:"errors"`
+}
+
+// scanProgress is the derived progress of a running scrub or resilver.
+type scanProgress struct {
+	Running bool
+	Paused  bool
+	Percent float64
+	Rate    float64   // issued bytes per second in the current pass
+	ETA     time.Time // zero if unknown
 }
 
 type vdev struct {
 	Name           string           `json:"name"`
 	VdevType       string           `json:"vdev_type"`
+	Class          string           `json:"class"`
 	State          string           `json:"state"`
 	AllocSpace     int64            `json:"alloc_space"`
 	TotalSpace     int64            `json:"total_space"`
@@ -41,15 +62,31 @@ type zpoolPool struct {
 	State      string           `json:"state"`
 	PoolGUID   uint64           `json:"pool_guid"` // uint64: value overflows int64
 	SpaVersion int              `json:"spa_version"`
+	Status     string           `json:"status"`
+	Action     string           `json:"action"`
+	MsgID      string           `json:"msgid"`
+	MoreInfo   string           `json:"moreinfo"`
 	ScanStats  scanStats        `json:"scan_stats"` // zero-value safe when absent
 	ErrorCount int              `json:"error_count"`
 	Vdevs      map[string]*vdev `json:"vdevs"`
+	Logs       map[string]*vdev `json:"logs"`
+	L2cache    map[string]*vdev `json:"l2cache"`
+	Spares     map[string]*vdev `json:"spares"`
+	Special    map[string]*vdev `json:"special"`
+	Dedup      map[string]*vdev `json:"dedup"`
 }
 
 type zpoolStatus struct {
 	Pools map[string]*zpoolPool `json:"pools"`
 }
 
+// Permanent errors from `zpool status -v -j`, decoded separately as they are only requested for pools with errors
+type zpoolErrorStatus struct {
+	Pools map[string]struct {
+		Errors json.RawMessage `json:"errors"`
+	} `json:"pools"`
+}
+
 type zpoolSensorEntry struct {
 	config  models.MqttConfig
 	domain  string
@@ -59,6 +96,132 @@ type zpoolSensorEntry struct {
 
 // ZpoolProvider runs `zpool status` and publishes per-pool and per-disk MQTT sensors.
 type ZpoolProvider struct {
+	config    models.Zpool
+	interval  time.Duration
+	execFn    func(context.Context, string, ...string) zpoolExecutor
+	lastScrub *scrubTimes
+	started   time.Time // when no scrub is known, the scrub age counts from here
+	disks     disk.Resolver
+	history   *allocHistory
+	changed   bool // a sample was added to the history in the current call of Entries
+}
+
+// Last completed scrub per pool GUID, survives a running scrub and a restart
+type scrubTimes struct {
+	path   string // JSON file in the state directory, empty to keep the times in memory only
+	times  map[uint64]time.Time
+	loaded bool
+	dirty  bool
+}
+
+// One sample of the allocated space of a pool
+type allocSample struct {
+	Time  time.Time `json:"time"`
+	Alloc int64     `json:"alloc"`
+}
+
+// Allocated space per pool GUID over the forecast window
+type allocHistory struct {
+	path    string // JSON file in the state directory, empty to keep the history in memory only
+	window  time.Duration
+	samples map[uint64][]allocSample
+	loaded  bool
+}
+
+// Rates of one pool or vdev line of `zpool iostat -l`, averaged over the sampling window
+type iostatLine struct {
+	ReadOps    float64
+	WriteOps   float64
+	ReadBytes  float64
+	WriteBytes float64
+	ReadWait   float64 // total wait in nanoseconds
+	WriteWait  float64
+}
+
+// IostatProvider runs `zpool iostat` and publishes per-pool and per-vdev throughput and latency sensors.
+type IostatProvider struct {
+	interval   time.Duration
+	retryDelay time.Duration
+	execFn     func(context.Context, string, ...string) zpoolExecutor
+	mu         sync.Mutex
+	last       []byte // output of the last completed sample
+}
+
+// JSON structs for `zpool get -j -p`
+
+// jsonString accepts both strings and numbers, as `--json-int` changes the type of numeric values.
+type jsonString string
+
+type zpoolProperty struct {
+	Value jsonString `json:"value"`
+}
+
+type zpoolGetPool struct {
+	Name       string                   `json:"name"`
+	PoolGUID   jsonString               `json:"pool_guid"`
+	SpaVersion jsonString               `json:"spa_version"`
+	Properties map[string]zpoolProperty `json:"properties"`
+}
+
+type zpoolGet struct {
+	Pools map[string]*zpoolGetPool `json:"pools"`
+}
+
+// PropsProvider runs `zpool get` and publishes pool property sensors.
+type PropsProvider struct {
 	interval time.Duration
 	execFn   func(context.Context, string, ...string) zpoolExecutor
 }
+
+// JSON structs for `smartctl -j -a`
+
+type smartAttribute struct {
+	ID  int `json:"id"`
+	Raw struct {
+		Value int64 `json:"value"`
+	} `json:"raw"`
+}
+
+type smartctlOutput struct {
+	Smartctl struct {
+		ExitStatus int `json:"exit_status"`
+	} `json:"smartctl"`
+	ModelName    string `json:"model_name"`
+	SerialNumber string `json:"serial_number"`
+	SmartStatus  *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	PowerOnTime *struct {
+		Hours int64 `json:"hours"`
+	} `json:"power_on_time"`
+	Temperature *struct {
+		Current int64 `json:"current"`
+	} `json:"temperature"`
+	AtaSmartAttributes struct {
+		Table []smartAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NvmeHealth *struct {
+		PercentageUsed int64 `json:"percentage_used"`
+		MediaErrors    int64 `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+	ScsiGrownDefectList *int64 `json:"scsi_grown_defect_list"`
+}
+
+// LocateProvider publishes a switch for the locate LED of every pool disk in an enclosure slot.
+type LocateProvider struct {
+	interval time.Duration
+	execFn   func(context.Context, string, ...string) zpoolExecutor
+	disks    disk.Resolver
+	bays     map[string]string
+	targets  map[string]string // block device by command topic, as of the last call of Entries
+}
+
+// SmartProvider runs smartctl for the disks of all pools and publishes SMART health sensors.
+type SmartProvider struct {
+	interval  time.Duration
+	execFn    func(context.Context, string, ...string) zpoolExecutor
+	resolve   func(string) (string, error) // vdev path to block device name
+	suspended func(string) bool            // block device runtime-suspended by the kernel
+	bays      map[string]string
+	last      map[string]*smartctlOutput // last SMART data per block device, kept while the disk is spun down
+}
@@ -0,0 +1,157 @@
+package zpool
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+func (s *jsonString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err == nil {
+		*s = jsonString(str)
+		return nil
+	}
+	var num json.Number
+	if err := json.Unmarshal(data, &num); err != nil {
+		return err
+	}
+	*s = jsonString(num)
+	return nil
+}
+
+func runZpoolGet(ctx context.Context, exec func(context.Context, string, ...string) zpoolExecutor) (*zpoolGet, error) {
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	out, err := exec(ctx, "zpool", "get", "-j", "-p", "all").Output()
+	if err != nil {
+		return nil, err
+	}
+	var get zpoolGet
+	if err := json.Unmarshal(out, &get); err != nil {
+		return nil, err
+	}
+	return &get, nil
+}
+
+// number returns a numeric property, or 0 if it is not set ("-").
+func (p *zpoolGetPool) number(name string) float64 {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(string(p.Properties[name].Value), "x"), 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
+
+// disabledFeatures returns the features that `zpool upgrade` would enable.
+func (p *zpoolGetPool) disabledFeatures() []string {
+	var features []string
+	for name, prop := range p.Properties {
+		if feature, ok := strings.CutPrefix(name, "feature@"); ok && prop.Value == "disabled" {
+			features = append(features, feature)
+		}
+	}
+	slices.Sort(features)
+	return features
+}
+
+// statusPool returns the fields shared with `zpool status`, so the sensors end up on the same device.
+func (p *zpoolGetPool) statusPool() (*zpoolPool, error) {
+	guid, err := strconv.ParseUint(string(p.PoolGUID), 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	version, err := strconv.Atoi(string(p.SpaVersion))
+	if err != nil {
+		return nil, err
+	}
+	return &zpoolPool{Name: p.Name, PoolGUID: guid, SpaVersion: version}, nil
+}
+
+// buildPropsEntries constructs the property sensors for one pool.
+func buildPropsEntries(pool *zpoolGetPool, interval time.Duration) ([]zpoolSensorEntry, error) {
+	statusPool, err := pool.statusPool()
+	if err != nil {
+		return nil, fmt.Errorf("pool %s: %w", pool.Name, err)
+	}
+	device := zpoolDevice(statusPool)
+	guid := statusPool.PoolGUID
+	var entries []zpoolSensorEntry
+	for _, s := range []struct {
+		suffix      string
+		name        string
+		deviceClass string
+		unit        string
+		format      string
+		val         float64
+	}{
+		{"fragmentation", "Fragmentation", "", "%", "%.0f", pool.number("fragmentation")},
+		{"capacity", "Capacity", "", "%", "%.0f", pool.number("capacity")},
+		{"dedupratio", "Dedup ratio", "", "x", "%.2f", pool.number("dedupratio")},
+		{"freeing", "Freeing space", "data_size", "GiB", "%.2f", pool.number("freeing") / gib},
+		{"leaked", "Leaked space", "data_size", "GiB", "%.2f", pool.number("leaked") / gib},
+		{"expandsize", "Expandable space", "data_size", "GiB", "%.2f", pool.number("expandsize") / gib},
+	} {
+		entries = append(entries, zpoolSensorEntry{
+			config:  makeSensorConfig(s.name, zpoolSensorUID(guid, s.suffix), "sensor", s.deviceClass, "measurement", s.unit, device, interval),
+			domain:  "sensor",
+			payload: func() []byte { return []byte(fmt.Sprintf(s.format, s.val)) },
+		})
+	}
+
+	autotrim := pool.Properties["autotrim"].Value == "on"
+	entries = append(entries, zpoolSensorEntry{
+		config:  makeSensorConfig("Autotrim", zpoolSensorUID(guid, "autotrim"), "binary_sensor", "", "", "", device, interval),
+		domain:  "binary_sensor",
+		payload: func() []byte { return mqttclient.BinaryPayload(autotrim) },
+	})
+
+	features := pool.disabledFeatures()
+	upgradeUID := zpoolSensorUID(guid, "upgrade")
+	upgradeCfg := makeSensorConfig("Feature upgrade", upgradeUID, "binary_sensor", "update", "", "", device, interval)
+	upgradeCfg.JsonAttributesTopic = zpoolAttrTopic("binary_sensor", upgradeUID)
+	entries = append(entries, zpoolSensorEntry{
+		config:  upgradeCfg,
+		domain:  "binary_sensor",
+		payload: func() []byte { return mqttclient.BinaryPayload(len(features) > 0) },
+		attrs:   func() ([]byte, error) { return json.Marshal(map[string]any{"disabled_features": features}) },
+	})
+	return entries, nil
+}
+
+// NewPropsProvider returns a provider that reads pool properties via `zpool get -j`.
+func NewPropsProvider(interval time.Duration) *PropsProvider {
+	return &PropsProvider{
+		interval: interval,
+		execFn:   func(ctx context.Context, name string, arg ...string) zpoolExecutor { return exec.CommandContext(ctx, name, arg...) },
+	}
+}
+
+// Entries runs zpool get and returns the property sensor entries for all pools.
+func (p *PropsProvider) Entries(ctx context.Context) ([]models.Entry, error) {
+	get, err := runZpoolGet(ctx, p.execFn)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.Entry
+	for _, pool := range get.Pools {
+		poolEntries, err := buildPropsEntries(pool, p.interval)
+		if err != nil {
+			return nil, err
+		}
+		converted, err := toEntries(poolEntries)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, converted...)
+	}
+	return entries, nil
+}
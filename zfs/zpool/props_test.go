@@ -0,0 +1,60 @@
+package zpool
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func TestRunZpoolGet(t *testing.T) {
+	get, err := runZpoolGet(context.Background(), zpoolFixtureExec(t, "zpoolget.json"))
+	require.NoError(t, err)
+	pool := get.Pools["data"]
+	require.NotNil(t, pool)
+	assert.Equal(t, 7.0, pool.number("fragmentation"))
+	assert.Equal(t, 1.0, pool.number("dedupratio"))
+	assert.Equal(t, 0.0, pool.number("expandsize"), "Expected unset property to be zero")
+	assert.Equal(t, []string{"block_cloning", "vdev_zaps_v2"}, pool.disabledFeatures())
+}
+
+func TestJsonStringAcceptsNumbers(t *testing.T) {
+	var pool zpoolGetPool
+	require.NoError(t, json.Unmarshal([]byte(`{"pool_guid": 16291491892042445671, "properties": {"capacity": {"value": 39}}}`), &pool))
+	assert.Equal(t, jsonString("16291491892042445671"), pool.PoolGUID)
+	assert.Equal(t, 39.0, pool.number("capacity"))
+}
+
+func TestPropsEntries(t *testing.T) {
+	provider := NewPropsProvider(20 * time.Minute)
+	provider.execFn = zpoolFixtureExec(t, "zpoolget.json")
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+
+	byUID := map[string]models.Entry{}
+	for _, e := range entries {
+		byUID[e.Config.UniqueID] = e
+	}
+	guid := uint64(16291491892042445671)
+	assert.Equal(t, "16291491892042445671", byUID[zpoolSensorUID(guid, "fragmentation")].Config.Device.Identifiers[0])
+	assert.Equal(t, []byte("7"), byUID[zpoolSensorUID(guid, "fragmentation")].Payload)
+	assert.Equal(t, []byte("39"), byUID[zpoolSensorUID(guid, "capacity")].Payload)
+	assert.Equal(t, []byte("1.00"), byUID[zpoolSensorUID(guid, "dedupratio")].Payload)
+	assert.Equal(t, []byte("ON"), byUID[zpoolSensorUID(guid, "autotrim")].Payload)
+
+	upgrade := byUID[zpoolSensorUID(guid, "upgrade")]
+	assert.Equal(t, "update", upgrade.Config.DeviceClass)
+	assert.Equal(t, []byte("ON"), upgrade.Payload)
+	var attrMap map[string]any
+	require.NoError(t, json.Unmarshal(upgrade.Attributes, &attrMap))
+	assert.Equal(t, []any{"block_cloning", "vdev_zaps_v2"}, attrMap["disabled_features"])
+}
+
+func TestPropsEntriesBadGUID(t *testing.T) {
+	_, err := buildPropsEntries(&zpoolGetPool{Name: "data", PoolGUID: "-"}, 20*time.Minute)
+	assert.Error(t, err)
+}
@@ -0,0 +1,147 @@
+package zpool
+
+import (
+	"encoding/json"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// vdevParity returns the parity level of a raidz or draid vdev from its name, like "raidz2-0" or "draid1:4d:8c:1s-0".
+func vdevParity(v *vdev) int {
+	for _, prefix := range []string{"raidz", "draid"} {
+		rest, ok := strings.CutPrefix(v.Name, prefix)
+		if !ok {
+			continue
+		}
+		if len(rest) > 0 && rest[0] >= '1' && rest[0] <= '3' {
+			return int(rest[0] - '0')
+		}
+		return 1
+	}
+	return 0
+}
+
+// Leaf states that no longer provide data. A DEGRADED leaf still serves its data, CANT_OPEN is how `zpool status -j` reports an unavailable device.
+var lostStates = []string{"FAULTED", "UNAVAIL", "REMOVED", "OFFLINE", "CANT_OPEN"}
+
+// vdevAvailable reports whether a child of a top-level vdev still provides its data.
+// Interior vdevs like "replacing" and "spare" are available if any of their children is.
+func vdevAvailable(v *vdev) bool {
+	if len(v.Vdevs) == 0 {
+		return !slices.Contains(lostStates, v.State)
+	}
+	for _, child := range v.Vdevs {
+		if vdevAvailable(child) {
+			return true
+		}
+	}
+	return false
+}
+
+// getRedundancy returns how many more device failures a top-level vdev can tolerate, and how many of its devices are lost.
+// A single-disk vdev has no redundancy to begin with; it is only lost if the disk is.
+func getRedundancy(v *vdev) (int, int) {
+	if len(v.Vdevs) == 0 {
+		if vdevAvailable(v) {
+			return 0, 0
+		}
+		return 0, 1
+	}
+	available := 0
+	for _, child := range v.Vdevs {
+		if vdevAvailable(child) {
+			available++
+		}
+	}
+	lost := len(v.Vdevs) - available
+	var margin int
+	switch v.VdevType {
+	case "mirror":
+		margin = available - 1
+	case "raidz", "draid":
+		margin = vdevParity(v) - lost
+	}
+	return max(0, margin), lost
+}
+
+// topLevelVdevs returns the top-level vdevs whose loss means the loss of the pool: data, special and dedup vdevs.
+func topLevelVdevs(pool *zpoolPool) []*vdev {
+	var tops []*vdev
+	if rootVdev := pool.Vdevs[pool.Name]; rootVdev != nil {
+		for _, top := range rootVdev.Vdevs {
+			tops = append(tops, top)
+		}
+	}
+	for _, top := range pool.Special {
+		tops = append(tops, top)
+	}
+	for _, top := range pool.Dedup {
+		tops = append(tops, top)
+	}
+	return tops
+}
+
+// buildRedundancyEntries constructs the redundancy sensors per top-level vdev, the pool-wide minimum and the critical problem sensor.
+// Only vdevs that lost devices down to no redundancy are critical; single-disk vdevs are listed separately as not redundant.
+func buildRedundancyEntries(pool *zpoolPool, device models.Device, interval time.Duration) []zpoolSensorEntry {
+	tops := topLevelVdevs(pool)
+	if len(tops) == 0 {
+		return nil
+	}
+	guid := pool.PoolGUID
+	var entries []zpoolSensorEntry
+	minimum := -1
+	critical := []string{}
+	nonRedundant := []string{}
+	for _, top := range tops {
+		margin, lost := getRedundancy(top)
+		redundant := len(top.Vdevs) > 0
+		if minimum < 0 || margin < minimum {
+			minimum = margin
+		}
+		switch {
+		case margin == 0 && lost > 0:
+			critical = append(critical, top.Name)
+		case !redundant:
+			nonRedundant = append(nonRedundant, top.Name)
+		}
+		uid := zpoolSensorUID(guid, mqttclient.NormalizeStr(top.Name)+"_redundancy")
+		cfg := makeSensorConfig(top.Name+" redundancy", uid, "sensor", "", "measurement", "", device, interval)
+		cfg.JsonAttributesTopic = zpoolAttrTopic("sensor", uid)
+		entries = append(entries, zpoolSensorEntry{
+			config:  cfg,
+			domain:  "sensor",
+			payload: func() []byte { return []byte(strconv.Itoa(margin)) },
+			attrs: func() ([]byte, error) {
+				return json.Marshal(map[string]any{"redundant": redundant, "lost": lost})
+			},
+		})
+	}
+	slices.Sort(critical)
+	slices.Sort(nonRedundant)
+
+	minUID := zpoolSensorUID(guid, "redundancy")
+	entries = append(entries, zpoolSensorEntry{
+		config:  makeSensorConfig("Pool redundancy", minUID, "sensor", "", "measurement", "", device, interval),
+		domain:  "sensor",
+		payload: func() []byte { return []byte(strconv.Itoa(minimum)) },
+	})
+
+	criticalUID := zpoolSensorUID(guid, "redundancy_critical")
+	criticalCfg := makeSensorConfig("Redundancy critical", criticalUID, "binary_sensor", "problem", "", "", device, interval)
+	criticalCfg.JsonAttributesTopic = zpoolAttrTopic("binary_sensor", criticalUID)
+	entries = append(entries, zpoolSensorEntry{
+		config:  criticalCfg,
+		domain:  "binary_sensor",
+		payload: func() []byte { return mqttclient.ProblemPayload(len(critical) == 0) },
+		attrs: func() ([]byte, error) {
+			return json.Marshal(map[string]any{"vdevs": critical, "not_redundant": nonRedundant})
+		},
+	})
+	return entries
+}
@@ -0,0 +1,106 @@
+package zpool
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func disks(states ...string) map[string]*vdev {
+	children := map[string]*vdev{}
+	for i, state := range states {
+		name := string(rune('a' + i))
+		children[name] = &vdev{Name: name, VdevType: "disk", State: state}
+	}
+	return children
+}
+
+func TestVdevParity(t *testing.T) {
+	assert.Equal(t, 1, vdevParity(&vdev{Name: "raidz1-0"}))
+	assert.Equal(t, 2, vdevParity(&vdev{Name: "raidz2-1"}))
+	assert.Equal(t, 3, vdevParity(&vdev{Name: "raidz3-0"}))
+	assert.Equal(t, 1, vdevParity(&vdev{Name: "raidz-0"}))
+	assert.Equal(t, 2, vdevParity(&vdev{Name: "draid2:4d:8c:1s-0"}))
+	assert.Equal(t, 0, vdevParity(&vdev{Name: "mirror-0"}))
+}
+
+func TestGetRedundancy(t *testing.T) {
+	cases := []struct {
+		name string
+		vdev *vdev
+		want int
+		lost int
+	}{
+		{"single disk", &vdev{Name: "sda", VdevType: "disk", State: "ONLINE"}, 0, 0},
+		{"lost single disk", &vdev{Name: "sda", VdevType: "disk", State: "FAULTED"}, 0, 1},
+		{"mirror", &vdev{Name: "mirror-0", VdevType: "mirror", Vdevs: disks("ONLINE", "ONLINE", "ONLINE")}, 2, 0},
+		{"degraded mirror", &vdev{Name: "mirror-0", VdevType: "mirror", Vdevs: disks("ONLINE", "FAULTED")}, 0, 1},
+		{"degraded leaf", &vdev{Name: "mirror-0", VdevType: "mirror", Vdevs: disks("ONLINE", "DEGRADED")}, 1, 0},
+		{"offline leaf", &vdev{Name: "mirror-0", VdevType: "mirror", Vdevs: disks("ONLINE", "OFFLINE")}, 0, 1},
+		{"raidz2", &vdev{Name: "raidz2-0", VdevType: "raidz", Vdevs: disks("ONLINE", "ONLINE", "ONLINE", "ONLINE")}, 2, 0},
+		{"degraded raidz2", &vdev{Name: "raidz2-0", VdevType: "raidz", Vdevs: disks("ONLINE", "UNAVAIL", "ONLINE", "ONLINE")}, 1, 1},
+		{"faulted raidz1", &vdev{Name: "raidz1-0", VdevType: "raidz", Vdevs: disks("ONLINE", "UNAVAIL", "REMOVED")}, 0, 2},
+		{"replacing", &vdev{Name: "mirror-0", VdevType: "mirror", Vdevs: map[string]*vdev{
+			"a":           {Name: "a", State: "ONLINE"},
+			"replacing-1": {Name: "replacing-1", VdevType: "replacing", Vdevs: disks("FAULTED", "ONLINE")},
+		}}, 1, 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			margin, lost := getRedundancy(c.vdev)
+			assert.Equal(t, c.want, margin)
+			assert.Equal(t, c.lost, lost)
+		})
+	}
+}
+
+func TestBuildRedundancyEntries(t *testing.T) {
+	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus2.json"))
+	require.NoError(t, err)
+	for name, want := range map[string]struct {
+		margin   string
+		critical string
+	}{"test": {"1", "OFF"}, "test2": {"0", "ON"}} {
+		pool := status.Pools[name]
+		byUID := map[string]zpoolSensorEntry{}
+		for _, e := range buildRedundancyEntries(pool, zpoolDevice(pool), 20*time.Minute) {
+			byUID[e.config.UniqueID] = e
+		}
+		assert.Equal(t, []byte(want.margin), byUID[zpoolSensorUID(pool.PoolGUID, "mirror-0_redundancy")].payload())
+		assert.Equal(t, []byte(want.margin), byUID[zpoolSensorUID(pool.PoolGUID, "redundancy")].payload())
+		critical := byUID[zpoolSensorUID(pool.PoolGUID, "redundancy_critical")]
+		assert.Equal(t, []byte(want.critical), critical.payload())
+		if want.critical == "ON" {
+			var attrMap map[string]any
+			attrs, err := critical.attrs()
+			require.NoError(t, err)
+			require.NoError(t, json.Unmarshal(attrs, &attrMap))
+			assert.Equal(t, []any{"mirror-0"}, attrMap["vdevs"])
+		}
+	}
+}
+
+func TestBuildRedundancyEntriesSingleDisk(t *testing.T) {
+	pool := &zpoolPool{Name: "tank", PoolGUID: 1, Vdevs: map[string]*vdev{"tank": {Name: "tank", Vdevs: map[string]*vdev{
+		"sda":      {Name: "sda", VdevType: "disk", State: "ONLINE"},
+		"mirror-1": {Name: "mirror-1", VdevType: "mirror", Vdevs: disks("ONLINE", "ONLINE")},
+	}}}}
+	byUID := map[string]zpoolSensorEntry{}
+	for _, e := range buildRedundancyEntries(pool, zpoolDevice(pool), 20*time.Minute) {
+		byUID[e.config.UniqueID] = e
+	}
+	assert.Equal(t, []byte("0"), byUID[zpoolSensorUID(1, "sda_redundancy")].payload())
+	attrs, err := byUID[zpoolSensorUID(1, "sda_redundancy")].attrs()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"redundant": false, "lost": 0}`, string(attrs))
+
+	critical := byUID[zpoolSensorUID(1, "redundancy_critical")]
+	assert.Equal(t, []byte("OFF"), critical.payload(), "Expected a healthy single disk not to be critical")
+	attrs, err = critical.attrs()
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"vdevs": [], "not_redundant": ["sda"]}`, string(attrs))
+}
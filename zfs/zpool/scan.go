@@ -0,0 +1,118 @@
+package zpool
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+const mib = float64(1 << 20)
+
+// payloadNone makes Home Assistant set an MQTT sensor to unknown.
+var payloadNone = []byte("None")
+
+// Scan functions that get their own set of sensors, so a resilver stands out from a routine scrub.
+var scanFunctions = []struct {
+	function string
+	key      string
+	name     string
+}{
+	{"SCRUB", "scrub", "Scrub"},
+	{"RESILVER", "resilver", "Resilver"},
+}
+
+// getScanProgress derives percentage, issue rate and ETA the same way `zpool status` does.
+func getScanProgress(s scanStats, now time.Time) scanProgress {
+	if s.State != "SCANNING" {
+		return scanProgress{}
+	}
+	progress := scanProgress{Running: true, Paused: s.ScrubPause != 0}
+	total := s.ToExamine - s.Skipped
+	if total > 0 {
+		progress.Percent = min(100, float64(s.Issued)/float64(total)*100)
+	}
+	elapsed := now.Unix() - s.PassStart - s.ScrubSpentPaused
+	if progress.Paused {
+		elapsed = s.ScrubPause - s.PassStart - s.ScrubSpentPaused
+	}
+	if elapsed <= 0 {
+		elapsed = 1
+	}
+	progress.Rate = float64(s.PassIssued) / float64(elapsed)
+	if !progress.Paused && progress.Rate > 0 && total >= s.Issued {
+		left := time.Duration(float64(total-s.Issued)/progress.Rate) * time.Second
+		progress.ETA = now.Add(left).Truncate(time.Second)
+	}
+	return progress
+}
+
+// buildScanEntries constructs the scrub and resilver progress sensors for one pool.
+func buildScanEntries(pool *zpoolPool, device models.Device, interval time.Duration, now time.Time) []zpoolSensorEntry {
+	guid := pool.PoolGUID
+	stats := pool.ScanStats
+	var entries []zpoolSensorEntry
+	for _, fn := range scanFunctions {
+		var progress scanProgress
+		if stats.Function == fn.function {
+			progress = getScanProgress(stats, now)
+		}
+
+		runningUID := zpoolSensorUID(guid, fn.key+"_running")
+		runningCfg := makeSensorConfig(fn.name+" running", runningUID, "binary_sensor", "running", "", "", device, interval)
+		runningCfg.JsonAttributesTopic = zpoolAttrTopic("binary_sensor", runningUID)
+		entries = append(entries, zpoolSensorEntry{
+			config:  runningCfg,
+			domain:  "binary_sensor",
+			payload: func() []byte { return mqttclient.BinaryPayload(progress.Running && !progress.Paused) },
+			attrs: func() ([]byte, error) {
+				m := map[string]any{"paused": progress.Paused}
+				if progress.Running {
+					m["examined"] = stats.Examined
+					m["issued"] = stats.Issued
+					m["to_examine"] = stats.ToExamine
+				}
+				return json.Marshal(m)
+			},
+		})
+
+		progressUID := zpoolSensorUID(guid, fn.key+"_progress")
+		entries = append(entries, zpoolSensorEntry{
+			config: makeSensorConfig(fn.name+" progress", progressUID, "sensor", "", "measurement", "%", device, interval),
+			domain: "sensor",
+			payload: func() []byte {
+				if !progress.Running {
+					return payloadNone
+				}
+				return []byte(fmt.Sprintf("%.2f", progress.Percent))
+			},
+		})
+
+		rateUID := zpoolSensorUID(guid, fn.key+"_rate")
+		entries = append(entries, zpoolSensorEntry{
+			config: makeSensorConfig(fn.name+" issue rate", rateUID, "sensor", "data_rate", "measurement", "MiB/s", device, interval),
+			domain: "sensor",
+			payload: func() []byte {
+				if !progress.Running {
+					return payloadNone
+				}
+				return []byte(fmt.Sprintf("%.2f", progress.Rate/mib))
+			},
+		})
+
+		etaUID := zpoolSensorUID(guid, fn.key+"_eta")
+		entries = append(entries, zpoolSensorEntry{
+			config: makeSensorConfig(fn.name+" estimated completion", etaUID, "sensor", "timestamp", "", "", device, interval),
+			domain: "sensor",
+			payload: func() []byte {
+				if progress.ETA.IsZero() {
+					return payloadNone
+				}
+				return []byte(progress.ETA.UTC().Format(time.RFC3339))
+			},
+		})
+	}
+	return entries
+}
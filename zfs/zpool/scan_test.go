@@ -0,0 +1,72 @@
+package zpool
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetScanProgressScanning(t *testing.T) {
+	now := time.Unix(1000, 0)
+	stats := scanStats{
+		Function:   "SCRUB",
+		State:      "SCANNING",
+		ToExamine:  1100,
+		Skipped:    100,
+		Issued:     250,
+		PassIssued: 200,
+		PassStart:  900,
+	}
+	progress := getScanProgress(stats, now)
+	assert.True(t, progress.Running)
+	assert.False(t, progress.Paused)
+	assert.InDelta(t, 25.0, progress.Percent, 0.001)
+	assert.InDelta(t, 2.0, progress.Rate, 0.001)
+	assert.Equal(t, now.Add(375*time.Second), progress.ETA)
+}
+
+func TestGetScanProgressPaused(t *testing.T) {
+	stats := scanStats{Function: "SCRUB", State: "SCANNING", ToExamine: 1000, Issued: 500, PassIssued: 500, PassStart: 900, ScrubPause: 1000}
+	progress := getScanProgress(stats, time.Unix(5000, 0))
+	assert.True(t, progress.Running)
+	assert.True(t, progress.Paused)
+	assert.InDelta(t, 5.0, progress.Rate, 0.001)
+	assert.True(t, progress.ETA.IsZero())
+}
+
+func TestGetScanProgressFinished(t *testing.T) {
+	stats := scanStats{Function: "SCRUB", State: "FINISHED", ToExamine: 1000, Issued: 1000}
+	assert.Equal(t, scanProgress{}, getScanProgress(stats, time.Now()))
+}
+
+func TestBuildScanEntriesResilverSeparate(t *testing.T) {
+	pool := &zpoolPool{
+		Name:     "data",
+		PoolGUID: 1,
+		ScanStats: scanStats{
+			Function:   "RESILVER",
+			State:      "SCANNING",
+			ToExamine:  1000,
+			Issued:     500,
+			PassIssued: 500,
+			PassStart:  900,
+		},
+	}
+	entries := buildScanEntries(pool, zpoolDevice(pool), 20*time.Minute, time.Unix(1000, 0))
+	byUID := map[string]zpoolSensorEntry{}
+	for _, e := range entries {
+		byUID[e.config.UniqueID] = e
+	}
+
+	resilver := byUID[zpoolSensorUID(1, "resilver_running")]
+	assert.Equal(t, "running", resilver.config.DeviceClass)
+	assert.Equal(t, []byte("ON"), resilver.payload())
+	assert.Equal(t, []byte("50.00"), byUID[zpoolSensorUID(1, "resilver_progress")].payload())
+	assert.Equal(t, []byte("1970-01-01T00:18:20Z"), byUID[zpoolSensorUID(1, "resilver_eta")].payload())
+
+	assert.Equal(t, []byte("OFF"), byUID[zpoolSensorUID(1, "scrub_running")].payload())
+	assert.Equal(t, []byte("None"), byUID[zpoolSensorUID(1, "scrub_progress")].payload())
+	assert.Equal(t, []byte("None"), byUID[zpoolSensorUID(1, "scrub_eta")].payload())
+	assert.Equal(t, []byte("None"), byUID[zpoolSensorUID(1, "scrub_rate")].payload())
+}
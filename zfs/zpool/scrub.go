@@ -0,0 +1,152 @@
+package zpool
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/mqttclient"
+)
+
+// Reasons for the scrub overdue problem sensor.
+const (
+	scrubOK       = "ok"
+	scrubNever    = "never scrubbed"
+	scrubOverdue  = "overdue"
+	scrubCanceled = "canceled"
+	scrubErrors   = "errors found"
+)
+
+// newScrubTimes returns the last scrubs, kept in a file of the state directory, or only in memory if the directory is empty.
+func newScrubTimes(stateDir string) *scrubTimes {
+	s := &scrubTimes{times: map[uint64]time.Time{}}
+	if stateDir != "" {
+		s.path = filepath.Join(stateDir, "zpool_scrub.json")
+	}
+	return s
+}
+
+// load reads the file once. A missing file means no known scrubs.
+func (s *scrubTimes) load() error {
+	if s.loaded || s.path == "" {
+		return nil
+	}
+	s.loaded = true
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.times)
+}
+
+// record remembers the end of a completed scrub.
+func (s *scrubTimes) record(guid uint64, end time.Time) {
+	if !s.times[guid].Equal(end) {
+		s.times[guid] = end
+		s.dirty = true
+	}
+}
+
+// save writes the file atomically if a scrub was recorded since the last save.
+func (s *scrubTimes) save() error {
+	if s.path == "" || !s.dirty {
+		return nil
+	}
+	data, err := json.Marshal(s.times)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// getScrubReason checks the latest scan and the last completed scrub against the maximum age.
+// If no scrub is known, because the last scan was a resilver, the pool is overdue once the maximum age has passed since startup.
+func getScrubReason(stats scanStats, lastScrub, started time.Time, maxAge time.Duration, now time.Time) string {
+	if stats.Function == "SCRUB" {
+		switch {
+		case stats.State == "CANCELED":
+			return scrubCanceled
+		case stats.State == "FINISHED" && stats.Errors > 0:
+			return scrubErrors
+		case stats.State == "SCANNING":
+			return scrubOK
+		}
+	}
+	if lastScrub.IsZero() {
+		if stats.Function == "" {
+			return scrubNever
+		}
+		if now.Sub(started) > maxAge {
+			return scrubOverdue
+		}
+		return scrubOK
+	}
+	if now.Sub(lastScrub) > maxAge {
+		return scrubOverdue
+	}
+	return scrubOK
+}
+
+// buildScrubEntries constructs the last scrub timestamp sensor and the scrub overdue problem sensor.
+// The last completed scrub is remembered in the state directory, as `zpool status` forgets it once a new scan starts.
+func (p *ZpoolProvider) buildScrubEntries(pool *zpoolPool, now time.Time) []zpoolSensorEntry {
+	device := zpoolDevice(pool)
+	guid := pool.PoolGUID
+	stats := pool.ScanStats
+	if stats.Function == "SCRUB" && stats.State == "FINISHED" && stats.EndTime != 0 {
+		p.lastScrub.record(guid, time.Unix(stats.EndTime, 0))
+	}
+	lastScrub := p.lastScrub.times[guid]
+	maxAge := time.Duration(p.config.ScrubMaxAgeDays) * 24 * time.Hour
+	reason := getScrubReason(stats, lastScrub, p.started, maxAge, now)
+
+	lastUID := zpoolSensorUID(guid, "last_scrub")
+	overdueUID := zpoolSensorUID(guid, "scrub_overdue")
+	overdueCfg := makeSensorConfig("Scrub overdue", overdueUID, "binary_sensor", "problem", "", "", device, p.interval)
+	overdueCfg.JsonAttributesTopic = zpoolAttrTopic("binary_sensor", overdueUID)
+	return []zpoolSensorEntry{
+		{
+			config: makeSensorConfig("Last scrub", lastUID, "sensor", "timestamp", "", "", device, p.interval),
+			domain: "sensor",
+			payload: func() []byte {
+				if lastScrub.IsZero() {
+					return payloadNone
+				}
+				return []byte(lastScrub.UTC().Format(time.RFC3339))
+			},
+		},
+		{
+			config:  overdueCfg,
+			domain:  "binary_sensor",
+			payload: func() []byte { return mqttclient.ProblemPayload(reason == scrubOK) },
+			attrs: func() ([]byte, error) {
+				m := map[string]any{
+					"reason":       reason,
+					"max_age_days": p.config.ScrubMaxAgeDays,
+					"scrub_errors": stats.Errors,
+				}
+				if !lastScrub.IsZero() {
+					m["last_scrub"] = lastScrub.UTC().Format(time.RFC3339)
+				}
+				return json.Marshal(m)
+			},
+		},
+	}
+}
@@ -0,0 +1,117 @@
+package zpool
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+func TestGetScrubReason(t *testing.T) {
+	now := time.Unix(100*86400, 0)
+	maxAge := 35 * 24 * time.Hour
+	recent := now.Add(-24 * time.Hour)
+	old := now.Add(-40 * 24 * time.Hour)
+	cases := []struct {
+		name  string
+		stats scanStats
+		last  time.Time
+		want  string
+	}{
+		{"recent", scanStats{Function: "SCRUB", State: "FINISHED"}, recent, scrubOK},
+		{"old", scanStats{Function: "SCRUB", State: "FINISHED"}, old, scrubOverdue},
+		{"canceled", scanStats{Function: "SCRUB", State: "CANCELED"}, recent, scrubCanceled},
+		{"errors", scanStats{Function: "SCRUB", State: "FINISHED", Errors: 3}, recent, scrubErrors},
+		{"running", scanStats{Function: "SCRUB", State: "SCANNING"}, old, scrubOK},
+		{"never", scanStats{}, time.Time{}, scrubNever},
+		{"resilver only", scanStats{Function: "RESILVER", State: "FINISHED"}, time.Time{}, scrubOK},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			assert.Equal(t, c.want, getScrubReason(c.stats, c.last, recent, maxAge, now))
+		})
+	}
+
+	// No known scrub since a startup longer ago than the maximum age
+	assert.Equal(t, scrubOverdue, getScrubReason(scanStats{Function: "RESILVER", State: "FINISHED"}, time.Time{}, old, maxAge, now))
+}
+
+func TestScrubAfterRestart(t *testing.T) {
+	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus.json"))
+	require.NoError(t, err)
+	pool := status.Pools["data"]
+	end := time.Unix(pool.ScanStats.EndTime, 0)
+	stateDir := t.TempDir()
+	provider := NewZpoolProvider(models.ZFSdefault().Zpool, stateDir, 20*time.Minute)
+	provider.buildScrubEntries(pool, end.Add(time.Hour))
+	require.NoError(t, provider.lastScrub.save())
+
+	// After a restart the last scan is a resilver, the scrub end is read from the state directory
+	pool.ScanStats = scanStats{Function: "RESILVER", State: "FINISHED", EndTime: end.Add(time.Hour).Unix()}
+	restarted := NewZpoolProvider(models.ZFSdefault().Zpool, stateDir, 20*time.Minute)
+	require.NoError(t, restarted.lastScrub.load())
+	byUID := map[string]zpoolSensorEntry{}
+	for _, e := range restarted.buildScrubEntries(pool, end.Add(36*24*time.Hour)) {
+		byUID[e.config.UniqueID] = e
+	}
+	assert.Equal(t, []byte(end.UTC().Format(time.RFC3339)), byUID[zpoolSensorUID(pool.PoolGUID, "last_scrub")].payload())
+	assert.Equal(t, []byte("ON"), byUID[zpoolSensorUID(pool.PoolGUID, "scrub_overdue")].payload())
+
+	// Without a state directory, no known scrub is overdue once the maximum age has passed since startup
+	fresh := NewZpoolProvider(models.ZFSdefault().Zpool, "", 20*time.Minute)
+	fresh.started = end
+	for _, e := range fresh.buildScrubEntries(pool, end.Add(24*time.Hour)) {
+		byUID[e.config.UniqueID] = e
+	}
+	assert.Equal(t, []byte("OFF"), byUID[zpoolSensorUID(pool.PoolGUID, "scrub_overdue")].payload())
+	for _, e := range fresh.buildScrubEntries(pool, end.Add(36*24*time.Hour)) {
+		byUID[e.config.UniqueID] = e
+	}
+	assert.Equal(t, []byte("None"), byUID[zpoolSensorUID(pool.PoolGUID, "last_scrub")].payload())
+	assert.Equal(t, []byte("ON"), byUID[zpoolSensorUID(pool.PoolGUID, "scrub_overdue")].payload())
+}
+
+func TestBuildScrubEntries(t *testing.T) {
+	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus.json"))
+	require.NoError(t, err)
+	pool := status.Pools["data"]
+	provider := NewZpoolProvider(models.ZFSdefault().Zpool, "", 20*time.Minute)
+	end := time.Unix(pool.ScanStats.EndTime, 0)
+
+	byUID := map[string]zpoolSensorEntry{}
+	for _, e := range provider.buildScrubEntries(pool, end.Add(24*time.Hour)) {
+		byUID[e.config.UniqueID] = e
+	}
+	last := byUID[zpoolSensorUID(pool.PoolGUID, "last_scrub")]
+	assert.Equal(t, "timestamp", last.config.DeviceClass)
+	assert.Equal(t, []byte(end.UTC().Format(time.RFC3339)), last.payload())
+	overdue := byUID[zpoolSensorUID(pool.PoolGUID, "scrub_overdue")]
+	assert.Equal(t, []byte("OFF"), overdue.payload())
+
+	// The last completed scrub is kept while a new scrub runs
+	pool.ScanStats.State = "SCANNING"
+	pool.ScanStats.EndTime = 0
+	for _, e := range provider.buildScrubEntries(pool, end.Add(48*time.Hour)) {
+		byUID[e.config.UniqueID] = e
+	}
+	last = byUID[zpoolSensorUID(pool.PoolGUID, "last_scrub")]
+	assert.Equal(t, []byte(end.UTC().Format(time.RFC3339)), last.payload())
+
+	// Overdue once the maximum age has passed
+	pool.ScanStats.State = "FINISHED"
+	pool.ScanStats.EndTime = end.Unix()
+	for _, e := range provider.buildScrubEntries(pool, end.Add(36*24*time.Hour)) {
+		byUID[e.config.UniqueID] = e
+	}
+	overdue = byUID[zpoolSensorUID(pool.PoolGUID, "scrub_overdue")]
+	assert.Equal(t, []byte("ON"), overdue.payload())
+	var attrMap map[string]any
+	attrs, err := overdue.attrs()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(attrs, &attrMap))
+	assert.Equal(t, scrubOverdue, attrMap["reason"])
+}
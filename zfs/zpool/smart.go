@@ -0,0 +1,234 @@
+package zpool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ykgmfq/SystemPub/models"
+	"github.com/ykgmfq/SystemPub/mqttclient"
+	"github.com/ykgmfq/SystemPub/zfs/disk"
+)
+
+// ATA SMART attribute IDs
+const (
+	ataReallocated = 5
+	ataPending     = 197
+)
+
+// diskStandby checks whether a disk is spun down, without waking it.
+// A disk that the kernel has runtime-suspended is checked in sysfs only; otherwise `hdparm -C` asks for the power mode.
+// Disks that hdparm cannot query, like NVMe, are active.
+func diskStandby(ctx context.Context, exec func(context.Context, string, ...string) zpoolExecutor, suspended func(string) bool, blockDev string) bool {
+	if suspended(blockDev) {
+		return true
+	}
+	if strings.HasPrefix(blockDev, "nvme") {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := exec(ctx, "hdparm", "-C", disk.DevPath(blockDev)).Output()
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		if state, ok := strings.CutPrefix(strings.TrimSpace(line), "drive state is:"); ok {
+			state = strings.TrimSpace(state)
+			return state == "standby" || state == "sleeping"
+		}
+	}
+	return false
+}
+
+// runSmartctl reads the SMART data of a disk. Callers check the power state first, as smartctl wakes spun down disks.
+// smartctl sets exit status bits for disk problems as well, so only bits 0 and 1 (command line, device open) are failures.
+func runSmartctl(ctx context.Context, exec func(context.Context, string, ...string) zpoolExecutor, devPath string) (*smartctlOutput, error) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	out, runErr := exec(ctx, "smartctl", "-j", "-a", devPath).Output()
+	smart := &smartctlOutput{}
+	if err := json.Unmarshal(out, smart); err != nil {
+		return nil, errors.Join(runErr, err)
+	}
+	if smart.Smartctl.ExitStatus&3 != 0 {
+		return nil, fmt.Errorf("smartctl %s: exit status %d", devPath, smart.Smartctl.ExitStatus)
+	}
+	return smart, nil
+}
+
+// ataRaw returns the raw value of an ATA SMART attribute.
+func (s *smartctlOutput) ataRaw(id int) (int64, bool) {
+	for _, attr := range s.AtaSmartAttributes.Table {
+		if attr.ID == id {
+			return attr.Raw.Value, true
+		}
+	}
+	return 0, false
+}
+
+// buildSmartEntries constructs the spun down and SMART sensors for one disk, next to the health sensor of its leaf vdev.
+// Values the disk does not report are skipped. A disk that has been spun down since startup has no SMART data yet,
+// so its sensors are unknown, with the values an ATA disk reports, to be discovered regardless of the power state.
+func buildSmartEntries(pool *zpoolPool, leaf poolLeaf, blockDev string, smart *smartctlOutput, standby bool, bays map[string]string, interval time.Duration) []zpoolSensorEntry {
+	device := zpoolDevice(pool)
+	diskKey := leaf.classKey + mqttclient.NormalizeStr(leaf.vdev.Name)
+	var serial string
+	if smart != nil {
+		serial = smart.SerialNumber
+	}
+	label := bayLabel(bays, serial, leaf.vdev.Name, leaf.className)
+	entries := []zpoolSensorEntry{{
+		config:  makeSensorConfig(label+" spun down", zpoolSensorUID(pool.PoolGUID, diskKey+"_standby"), "binary_sensor", "", "", "", device, interval),
+		domain:  "binary_sensor",
+		payload: func() []byte { return mqttclient.BinaryPayload(standby) },
+	}}
+	known := smart != nil
+	if !known {
+		smart = &smartctlOutput{}
+	}
+
+	passed := smart.SmartStatus == nil || smart.SmartStatus.Passed
+	statusUID := zpoolSensorUID(pool.PoolGUID, diskKey+"_smart")
+	statusCfg := makeSensorConfig(label+" SMART status", statusUID, "binary_sensor", "problem", "", "", device, interval)
+	statusCfg.JsonAttributesTopic = zpoolAttrTopic("binary_sensor", statusUID)
+	entries = append(entries, zpoolSensorEntry{
+		config: statusCfg,
+		domain: "binary_sensor",
+		payload: func() []byte {
+			if !known {
+				return payloadNone
+			}
+			return mqttclient.ProblemPayload(passed)
+		},
+		attrs: func() ([]byte, error) {
+			return json.Marshal(map[string]any{
+				"device":      disk.DevPath(blockDev),
+				"model":       smart.ModelName,
+				"serial":      smart.SerialNumber,
+				"exit_status": smart.Smartctl.ExitStatus,
+				"stale":       standby,
+			})
+		},
+	})
+
+	type value struct {
+		suffix      string
+		name        string
+		deviceClass string
+		stateClass  string
+		unit        string
+		val         int64
+	}
+	var values []value
+	if !known {
+		values = []value{
+			{"_reallocated", "reallocated sectors", "", "measurement", "", 0},
+			{"_pending", "pending sectors", "", "measurement", "", 0},
+			{"_power_on", "power-on hours", "duration", "total_increasing", "h", 0},
+			{"_temperature", "temperature", "temperature", "measurement", "°C", 0},
+		}
+	}
+	if raw, ok := smart.ataRaw(ataReallocated); ok {
+		values = append(values, value{"_reallocated", "reallocated sectors", "", "measurement", "", raw})
+	} else if smart.ScsiGrownDefectList != nil {
+		values = append(values, value{"_reallocated", "reallocated sectors", "", "measurement", "", *smart.ScsiGrownDefectList})
+	}
+	if raw, ok := smart.ataRaw(ataPending); ok {
+		values = append(values, value{"_pending", "pending sectors", "", "measurement", "", raw})
+	}
+	if smart.PowerOnTime != nil {
+		values = append(values, value{"_power_on", "power-on hours", "duration", "total_increasing", "h", smart.PowerOnTime.Hours})
+	}
+	if smart.Temperature != nil {
+		values = append(values, value{"_temperature", "temperature", "temperature", "measurement", "°C", smart.Temperature.Current})
+	}
+	if smart.NvmeHealth != nil {
+		values = append(values, value{"_percentage_used", "percentage used", "", "measurement", "%", smart.NvmeHealth.PercentageUsed})
+	}
+	for _, v := range values {
+		uid := zpoolSensorUID(pool.PoolGUID, diskKey+v.suffix)
+		entries = append(entries, zpoolSensorEntry{
+			config: makeSensorConfig(label+" "+v.name, uid, "sensor", v.deviceClass, v.stateClass, v.unit, device, interval),
+			domain: "sensor",
+			payload: func() []byte {
+				if !known {
+					return payloadNone
+				}
+				return []byte(strconv.FormatInt(v.val, 10))
+			},
+		})
+	}
+	return entries
+}
+
+// NewSmartProvider returns a provider that reads SMART data via `smartctl -j`.
+func NewSmartProvider(config models.Zpool, interval time.Duration) *SmartProvider {
+	resolver := disk.NewResolver()
+	return &SmartProvider{
+		interval: interval,
+		bays:     config.Bays,
+		last:     make(map[string]*smartctlOutput),
+		execFn: func(ctx context.Context, name string, arg ...string) zpoolExecutor {
+			return exec.CommandContext(ctx, name, arg...)
+		},
+		resolve:   resolver.BlockDevice,
+		suspended: resolver.Suspended,
+	}
+}
+
+// Entries runs smartctl for every disk of every pool and returns the SMART sensor entries.
+// Disks that cannot be resolved or read are skipped, so one unsupported disk does not hide the others.
+// Spun down disks are not woken up; their last known SMART values are published again, or unknown values before the first read.
+func (p *SmartProvider) Entries(ctx context.Context) ([]models.Entry, error) {
+	status, err := runZpool(ctx, p.execFn)
+	if err != nil {
+		return nil, err
+	}
+	var entries []models.Entry
+	// Partitions of one disk, like log and special vdevs on a single NVMe, share the reads of the disk
+	type diskRead struct {
+		standby bool
+		err     error
+	}
+	reads := map[string]diskRead{}
+	for _, pool := range status.Pools {
+		for _, leaf := range poolLeaves(pool) {
+			if leaf.vdev.VdevType != "disk" || leaf.vdev.Path == "" {
+				continue
+			}
+			blockDev, err := p.resolve(leaf.vdev.Path)
+			if err != nil {
+				Logger.Warn().Str("mod", "zpool").Str("vdev", leaf.vdev.Name).Err(err).Msg("Could not resolve block device")
+				continue
+			}
+			read, done := reads[blockDev]
+			if !done {
+				read.standby = diskStandby(ctx, p.execFn, p.suspended, blockDev)
+				if !read.standby {
+					var smart *smartctlOutput
+					smart, read.err = runSmartctl(ctx, p.execFn, disk.DevPath(blockDev))
+					if read.err == nil {
+						p.last[blockDev] = smart
+					}
+				}
+				reads[blockDev] = read
+			}
+			if read.err != nil {
+				Logger.Warn().Str("mod", "zpool").Str("vdev", leaf.vdev.Name).Err(read.err).Msg("Could not read SMART data")
+				continue
+			}
+			converted, err := toEntries(buildSmartEntries(pool, leaf, blockDev, p.last[blockDev], read.standby, p.bays, p.interval))
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, converted...)
+		}
+	}
+	return entries, nil
+}
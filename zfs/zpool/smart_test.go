@@ -0,0 +1,183 @@
+package zpool
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
+)
+
+// smartExec serves the pool status fixture and the smartctl fixtures per device.
+func smartExec(t *testing.T) func(context.Context, string, ...string) zpoolExecutor {
+	t.Helper()
+	files := map[string]string{
+		"zpool":        "zoolstatus3.json",
+		"/dev/sda":     "smartctl_ata.json",
+		"/dev/nvme0n1": "smartctl_nvme.json",
+	}
+	data := map[string][]byte{}
+	for key, file := range files {
+		content, err := os.ReadFile(file)
+		require.NoError(t, err)
+		data[key] = content
+	}
+	return func(_ context.Context, name string, arg ...string) zpoolExecutor {
+		switch name {
+		case "zpool":
+			return &mockZpoolCmd{data: data["zpool"]}
+		case "hdparm":
+			return &mockZpoolCmd{data: []byte("\n" + arg[len(arg)-1] + ":\n drive state is:  active/idle\n")}
+		}
+		if content, ok := data[arg[len(arg)-1]]; ok {
+			return &mockZpoolCmd{data: content}
+		}
+		return &mockZpoolCmd{data: []byte(`{"smartctl": {"exit_status": 2}}`), err: os.ErrNotExist}
+	}
+}
+
+func TestRunSmartctlDiskProblemBits(t *testing.T) {
+	smart, err := runSmartctl(context.Background(), smartExec(t), "/dev/sda")
+	require.NoError(t, err, "Expected exit status bit 2 not to be a failure")
+	raw, ok := smart.ataRaw(ataReallocated)
+	assert.True(t, ok)
+	assert.Equal(t, int64(8), raw)
+
+	_, err = runSmartctl(context.Background(), smartExec(t), "/dev/sdx")
+	assert.Error(t, err)
+}
+
+func TestDiskStandby(t *testing.T) {
+	var hdparmCalls int
+	exec := func(state string) func(context.Context, string, ...string) zpoolExecutor {
+		return func(_ context.Context, name string, arg ...string) zpoolExecutor {
+			assert.Equal(t, []string{"-C", "/dev/sda"}, arg)
+			hdparmCalls++
+			return &mockZpoolCmd{data: []byte("\n/dev/sda:\n drive state is:  " + state + "\n")}
+		}
+	}
+	notSuspended := func(string) bool { return false }
+	assert.True(t, diskStandby(context.Background(), exec("standby"), notSuspended, "sda"))
+	assert.True(t, diskStandby(context.Background(), exec("sleeping"), notSuspended, "sda"))
+	assert.False(t, diskStandby(context.Background(), exec("active/idle"), notSuspended, "sda"))
+	assert.False(t, diskStandby(context.Background(), func(context.Context, string, ...string) zpoolExecutor {
+		return &mockZpoolCmd{err: os.ErrNotExist}
+	}, notSuspended, "sda"), "Expected a disk hdparm cannot query to be active")
+
+	hdparmCalls = 0
+	assert.True(t, diskStandby(context.Background(), exec("active/idle"), func(string) bool { return true }, "sda"))
+	assert.False(t, diskStandby(context.Background(), exec("active/idle"), notSuspended, "nvme0n1"))
+	assert.Zero(t, hdparmCalls, "Expected runtime-suspended and NVMe disks not to be queried")
+}
+
+func TestSmartEntriesStandby(t *testing.T) {
+	standby := false
+	provider := NewSmartProvider(models.ZFSdefault().Zpool, 20*time.Minute)
+	active := smartExec(t)
+	provider.execFn = func(ctx context.Context, name string, arg ...string) zpoolExecutor {
+		switch name {
+		case "smartctl":
+			assert.False(t, standby, "Expected smartctl not to wake the disk")
+		case "hdparm":
+			if standby {
+				return &mockZpoolCmd{data: []byte("\n/dev/sda:\n drive state is:  standby\n")}
+			}
+		}
+		return active(ctx, name, arg...)
+	}
+	provider.suspended = func(string) bool { return false }
+	provider.resolve = func(path string) (string, error) {
+		if path == "/dev/sda1" {
+			return "sda", nil
+		}
+		return "", os.ErrNotExist
+	}
+	guid := uint64(5558451263911426331)
+	byUID := func() map[string]models.Entry {
+		entries, err := provider.Entries(context.Background())
+		require.NoError(t, err)
+		m := map[string]models.Entry{}
+		for _, e := range entries {
+			m[e.Config.UniqueID] = e
+		}
+		return m
+	}
+
+	// Spun down before any SMART data was read: the SMART sensors are discovered with unknown values
+	standby = true
+	entries := byUID()
+	assert.Equal(t, []byte("ON"), entries[zpoolSensorUID(guid, "sda_standby")].Payload)
+	assert.Equal(t, "sda spun down", entries[zpoolSensorUID(guid, "sda_standby")].Config.Name)
+	assert.Equal(t, []byte("None"), entries[zpoolSensorUID(guid, "sda_smart")].Payload)
+	assert.Equal(t, []byte("None"), entries[zpoolSensorUID(guid, "sda_temperature")].Payload)
+	assert.Equal(t, "sda temperature", entries[zpoolSensorUID(guid, "sda_temperature")].Config.Name)
+
+	standby = false
+	entries = byUID()
+	assert.Equal(t, []byte("OFF"), entries[zpoolSensorUID(guid, "sda_standby")].Payload)
+	assert.Equal(t, []byte("35"), entries[zpoolSensorUID(guid, "sda_temperature")].Payload)
+
+	// Spun down again: the last known values are kept
+	standby = true
+	entries = byUID()
+	assert.Equal(t, []byte("ON"), entries[zpoolSensorUID(guid, "sda_standby")].Payload)
+	assert.Equal(t, []byte("35"), entries[zpoolSensorUID(guid, "sda_temperature")].Payload)
+	assert.Contains(t, string(entries[zpoolSensorUID(guid, "sda_smart")].Attributes), `"stale":true`)
+}
+
+func TestSmartEntries(t *testing.T) {
+	provider := NewSmartProvider(models.ZFSdefault().Zpool, 20*time.Minute)
+	runs := map[string]int{}
+	fixtureExec := smartExec(t)
+	provider.execFn = func(ctx context.Context, name string, arg ...string) zpoolExecutor {
+		if name == "smartctl" {
+			runs[arg[len(arg)-1]]++
+		}
+		return fixtureExec(ctx, name, arg...)
+	}
+	provider.suspended = func(string) bool { return false }
+	provider.resolve = func(path string) (string, error) {
+		switch path {
+		case "/dev/sda1":
+			return "sda", nil
+		case "/dev/nvme0n1p1", "/dev/nvme0n1p2":
+			return "nvme0n1", nil
+		}
+		return "", os.ErrNotExist
+	}
+	entries, err := provider.Entries(context.Background())
+	require.NoError(t, err)
+
+	byUID := map[string]models.Entry{}
+	for _, e := range entries {
+		byUID[e.Config.UniqueID] = e
+	}
+	guid := uint64(5558451263911426331)
+
+	status := byUID[zpoolSensorUID(guid, "sda_smart")]
+	assert.Equal(t, "sda SMART status", status.Config.Name)
+	assert.Equal(t, []byte("OFF"), status.Payload)
+	var attrMap map[string]any
+	require.NoError(t, json.Unmarshal(status.Attributes, &attrMap))
+	assert.Equal(t, "/dev/sda", attrMap["device"])
+	assert.Equal(t, []byte("8"), byUID[zpoolSensorUID(guid, "sda_reallocated")].Payload)
+	assert.Equal(t, []byte("1"), byUID[zpoolSensorUID(guid, "sda_pending")].Payload)
+	assert.Equal(t, []byte("43512"), byUID[zpoolSensorUID(guid, "sda_power_on")].Payload)
+	assert.Equal(t, []byte("35"), byUID[zpoolSensorUID(guid, "sda_temperature")].Payload)
+	assert.NotContains(t, byUID, zpoolSensorUID(guid, "sda_percentage_used"))
+
+	// NVMe partitions in the log and special class, with the failing SMART status
+	assert.Equal(t, []byte("ON"), byUID[zpoolSensorUID(guid, "log_nvme0n1p1_smart")].Payload)
+	assert.Equal(t, "Special nvme0n1p2 percentage used", byUID[zpoolSensorUID(guid, "special_nvme0n1p2_percentage_used")].Config.Name)
+	assert.Equal(t, []byte("12"), byUID[zpoolSensorUID(guid, "special_nvme0n1p2_percentage_used")].Payload)
+	assert.NotContains(t, byUID, zpoolSensorUID(guid, "log_nvme0n1p1_reallocated"))
+
+	// Unresolvable disks are skipped
+	assert.NotContains(t, byUID, zpoolSensorUID(guid, "sdb_smart"))
+
+	assert.Equal(t, map[string]int{"/dev/sda": 1, "/dev/nvme0n1": 1}, runs, "Expected one smartctl run per disk")
+}
@@ -6,15 +6,42 @@ import (
 	"encoding/json"
 	"fmt"
 	"os/exec"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/rs/zerolog"
 	"github.com/ykgmfq/SystemPub/models"
 	"github.com/ykgmfq/SystemPub/mqttclient"
+	"github.com/ykgmfq/SystemPub/zfs/disk"
 )
 
+var Logger zerolog.Logger
+
 const gib = float64(1 << 30)
 
+// Message IDs of `zpool status`, see https://openzfs.github.io/openzfs-docs/msg/
+var msgIDs = []string{
+	"none",
+	"ZFS-8000-14", "ZFS-8000-2Q", "ZFS-8000-3C", "ZFS-8000-4J", "ZFS-8000-5E",
+	"ZFS-8000-6X", "ZFS-8000-72", "ZFS-8000-8A", "ZFS-8000-9P", "ZFS-8000-A5",
+	"ZFS-8000-ER", "ZFS-8000-EY", "ZFS-8000-HC", "ZFS-8000-JQ", "ZFS-8000-K4",
+	"other",
+}
+
+// getMsgID maps a message ID to one of the enum options.
+func getMsgID(msgID string) string {
+	switch {
+	case msgID == "":
+		return "none"
+	case slices.Contains(msgIDs, msgID):
+		return msgID
+	default:
+		return "other"
+	}
+}
+
 func runZpool(ctx context.Context, exec func(context.Context, string, ...string) zpoolExecutor) (*zpoolStatus, error) {
 	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
@@ -84,8 +111,54 @@ func makeSensorConfig(name, uid, domain, deviceClass, stateClass, unit string, d
 	return cfg
 }
 
+// buildDiskEntries constructs the health and error sensors for one leaf vdev.
+// Devices outside the normal allocation class get their class as key and name prefix.
+func buildDiskEntries(leaf *vdev, classKey, className string, disks poolDisks, device models.Device, guid uint64, interval time.Duration) []zpoolSensorEntry {
+	diskKey := classKey + mqttclient.NormalizeStr(leaf.Name)
+	label := disks.label(leaf, className)
+	var entries []zpoolSensorEntry
+
+	diskHealthUID := zpoolSensorUID(guid, diskKey+"_health")
+	diskHealthCfg := makeSensorConfig(label+" health", diskHealthUID, "binary_sensor", "problem", "", "", device, interval)
+	diskHealthCfg.JsonAttributesTopic = zpoolAttrTopic("binary_sensor", diskHealthUID)
+	entries = append(entries, zpoolSensorEntry{
+		config:  diskHealthCfg,
+		domain:  "binary_sensor",
+		payload: func() []byte { return mqttclient.ProblemPayload(leaf.State == "ONLINE") },
+		attrs: func() ([]byte, error) {
+			m := map[string]any{"slow_ios": leaf.SlowIOs}
+			if leaf.Path != "" {
+				m["path"] = leaf.Path
+			}
+			if leaf.DevID != "" {
+				m["devid"] = leaf.DevID
+			}
+			disks.addIdentity(leaf, m)
+			return json.Marshal(m)
+		},
+	})
+
+	for _, s := range []struct {
+		suffix string
+		name   string
+		val    int64
+	}{
+		{diskKey + "_read_errors", label + " read errors", leaf.ReadErrors},
+		{diskKey + "_write_errors", label + " write errors", leaf.WriteErrors},
+		{diskKey + "_checksum_errors", label + " checksum errors", leaf.ChecksumErrors},
+	} {
+		uid := zpoolSensorUID(guid, s.suffix)
+		entries = append(entries, zpoolSensorEntry{
+			config:  makeSensorConfig(s.name, uid, "sensor", "", "total_increasing", "", device, interval),
+			domain:  "sensor",
+			payload: func() []byte { return []byte(strconv.FormatInt(s.val, 10)) },
+		})
+	}
+	return entries
+}
+
 // buildPoolEntries constructs all binary_sensor and sensor entries for one pool.
-func buildPoolEntries(pool *zpoolPool, interval time.Duration) []zpoolSensorEntry {
+func buildPoolEntries(pool *zpoolPool, disks poolDisks, interval time.Duration) []zpoolSensorEntry {
 	device := zpoolDevice(pool)
 	guid := pool.PoolGUID
 	var entries []zpoolSensorEntry
@@ -107,10 +180,32 @@ func buildPoolEntries(pool *zpoolPool, interval time.Duration) []zpoolSensorEntr
 				m["scrub_start"] = time.Unix(pool.ScanStats.StartTime, 0).UTC().Format(time.RFC3339)
 				m["scrub_end"] = time.Unix(pool.ScanStats.EndTime, 0).UTC().Format(time.RFC3339)
 			}
+			for key, val := range map[string]string{
+				"status":   pool.Status,
+				"action":   pool.Action,
+				"msgid":    pool.MsgID,
+				"moreinfo": pool.MoreInfo,
+			} {
+				if val != "" {
+					m[key] = strings.Join(strings.Fields(val), " ")
+				}
+			}
 			return json.Marshal(m)
 		},
 	})
 
+	// Status message ID, like ZFS-8000-4J
+	msgidCfg := makeSensorConfig("Status message", zpoolSensorUID(guid, "msgid"), "sensor", "enum", "", "", device, interval)
+	msgidCfg.Options = msgIDs
+	entries = append(entries, zpoolSensorEntry{
+		config:  msgidCfg,
+		domain:  "sensor",
+		payload: func() []byte { return []byte(getMsgID(pool.MsgID)) },
+	})
+
+	// Scrub and resilver progress sensors
+	entries = append(entries, buildScanEntries(pool, device, interval, time.Now())...)
+
 	// Capacity sensors (from root vdev)
 	rootVdev := pool.Vdevs[pool.Name]
 	if rootVdev != nil {
@@ -139,6 +234,9 @@ func buildPoolEntries(pool *zpoolPool, interval time.Duration) []zpoolSensorEntr
 		})
 	}
 
+	// Redundancy sensors per top-level vdev
+	entries = append(entries, buildRedundancyEntries(pool, device, interval)...)
+
 	// Error sensors
 	errVal := int64(pool.ErrorCount)
 	errUID := zpoolSensorUID(guid, "errors")
@@ -159,56 +257,49 @@ func buildPoolEntries(pool *zpoolPool, interval time.Duration) []zpoolSensorEntr
 	// Per-disk entries
 	if rootVdev != nil {
 		for _, leaf := range collectLeafVdevs(rootVdev) {
-			leaf := leaf
-			diskKey := mqttclient.NormalizeStr(leaf.Name)
-
-			diskHealthUID := zpoolSensorUID(guid, diskKey+"_health")
-			diskHealthCfg := makeSensorConfig(leaf.Name+" health", diskHealthUID, "binary_sensor", "problem", "", "", device, interval)
-			diskHealthCfg.JsonAttributesTopic = zpoolAttrTopic("binary_sensor", diskHealthUID)
-			entries = append(entries, zpoolSensorEntry{
-				config:  diskHealthCfg,
-				domain:  "binary_sensor",
-				payload: func() []byte { return mqttclient.ProblemPayload(leaf.State == "ONLINE") },
-				attrs: func() ([]byte, error) {
-					m := map[string]any{"slow_ios": leaf.SlowIOs}
-					if leaf.Path != "" {
-						m["path"] = leaf.Path
-					}
-					if leaf.DevID != "" {
-						m["devid"] = leaf.DevID
-					}
-					return json.Marshal(m)
-				},
-			})
-
-			for _, s := range []struct {
-				suffix string
-				name   string
-				val    int64
-			}{
-				{diskKey + "_read_errors", leaf.Name + " read errors", leaf.ReadErrors},
-				{diskKey + "_write_errors", leaf.Name + " write errors", leaf.WriteErrors},
-				{diskKey + "_checksum_errors", leaf.Name + " checksum errors", leaf.ChecksumErrors},
-			} {
-				s := s
-				uid := zpoolSensorUID(guid, s.suffix)
-				entries = append(entries, zpoolSensorEntry{
-					config:  makeSensorConfig(s.name, uid, "sensor", "", "total_increasing", "", device, interval),
-					domain:  "sensor",
-					payload: func() []byte { return []byte(strconv.FormatInt(s.val, 10)) },
-				})
-			}
+			entries = append(entries, buildDiskEntries(leaf, "", "", disks, device, guid, interval)...)
 		}
 	}
 
+	// Log, cache, special and dedup devices, and spares
+	entries = append(entries, buildClassEntries(pool, disks, device, interval)...)
+
 	return entries
 }
 
+// toEntries evaluates the payload and attributes of sensor entries.
+func toEntries(sensors []zpoolSensorEntry) ([]models.Entry, error) {
+	entries := make([]models.Entry, 0, len(sensors))
+	for _, e := range sensors {
+		var attrs []byte
+		if e.attrs != nil {
+			var err error
+			attrs, err = e.attrs()
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries = append(entries, models.Entry{
+			Config:     e.config,
+			Domain:     e.domain,
+			Payload:    e.payload(),
+			Attributes: attrs,
+		})
+	}
+	return entries, nil
+}
+
 // NewZpoolProvider returns a provider that reads pool status via `zpool status -j`.
-func NewZpoolProvider(interval time.Duration) *ZpoolProvider {
+// The last scrubs and the allocated space history for the capacity forecast are kept in the state directory.
+func NewZpoolProvider(config models.Zpool, stateDir string, interval time.Duration) *ZpoolProvider {
 	return &ZpoolProvider{
-		interval: interval,
-		execFn:   func(ctx context.Context, name string, arg ...string) zpoolExecutor { return exec.CommandContext(ctx, name, arg...) },
+		config:    validateCapacity(config),
+		interval:  interval,
+		execFn:    func(ctx context.Context, name string, arg ...string) zpoolExecutor { return exec.CommandContext(ctx, name, arg...) },
+		lastScrub: newScrubTimes(stateDir),
+		started:   time.Now(),
+		disks:     disk.NewResolver(),
+		history:   newAllocHistory(stateDir, config.ForecastDays),
 	}
 }
 
@@ -219,22 +310,33 @@ func (p *ZpoolProvider) Entries(ctx context.Context) ([]models.Entry, error) {
 		return nil, err
 	}
 	var entries []models.Entry
+	now := time.Now()
+	if err := p.history.load(); err != nil {
+		Logger.Warn().Str("mod", "zpool").Err(err).Msg("Could not read allocation history")
+	}
+	if err := p.lastScrub.load(); err != nil {
+		Logger.Warn().Str("mod", "zpool").Err(err).Msg("Could not read last scrubs")
+	}
+	p.changed = false
 	for _, pool := range status.Pools {
-		for _, e := range buildPoolEntries(pool, p.interval) {
-			var attrs []byte
-			if e.attrs != nil {
-				attrs, err = e.attrs()
-				if err != nil {
-					return nil, err
-				}
-			}
-			entries = append(entries, models.Entry{
-				Config:     e.config,
-				Domain:     e.domain,
-				Payload:    e.payload(),
-				Attributes: attrs,
-			})
+		poolEntries := buildPoolEntries(pool, lookupDisks(p.disks, pool, p.config.Bays), p.interval)
+		poolEntries = append(poolEntries, p.buildScrubEntries(pool, now)...)
+		poolEntries = append(poolEntries, p.buildDataErrorEntries(ctx, pool)...)
+		poolEntries = append(poolEntries, p.buildForecastEntries(pool, now)...)
+		poolEntries = append(poolEntries, p.buildCapacityEntries(pool)...)
+		converted, err := toEntries(poolEntries)
+		if err != nil {
+			return nil, err
 		}
+		entries = append(entries, converted...)
+	}
+	if p.changed {
+		if err := p.history.save(); err != nil {
+			Logger.Warn().Str("mod", "zpool").Err(err).Msg("Could not save allocation history")
+		}
+	}
+	if err := p.lastScrub.save(); err != nil {
+		Logger.Warn().Str("mod", "zpool").Err(err).Msg("Could not save last scrubs")
 	}
 	return entries, nil
 }
@@ -9,6 +9,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"github.com/ykgmfq/SystemPub/models"
 )
 
 type mockZpoolCmd struct {
@@ -67,7 +68,7 @@ func TestBuildPoolEntriesHealthy(t *testing.T) {
 	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus.json"))
 	require.NoError(t, err)
 	pool := status.Pools["data"]
-	entries := buildPoolEntries(pool, 20*time.Minute)
+	entries := buildPoolEntries(pool, poolDisks{}, 20*time.Minute)
 
 	byUID := map[string]zpoolSensorEntry{}
 	for _, e := range entries {
@@ -120,20 +121,40 @@ func TestBuildPoolEntriesDegraded(t *testing.T) {
 	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus2.json"))
 	require.NoError(t, err)
 	pool := status.Pools["test2"]
-	entries := buildPoolEntries(pool, 20*time.Minute)
+	entries := buildPoolEntries(pool, poolDisks{}, 20*time.Minute)
 	byUID := map[string]zpoolSensorEntry{}
 	for _, e := range entries {
 		byUID[e.config.UniqueID] = e
 	}
 	health := byUID[zpoolSensorUID(pool.PoolGUID, "health")]
 	assert.Equal(t, []byte("ON"), health.payload())
+
+	// Status message attributes, with the line breaks of the CLI output removed
+	var attrMap map[string]any
+	attrsData, err := health.attrs()
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(attrsData, &attrMap))
+	assert.Equal(t, "Replace the device using 'zpool replace'.", attrMap["action"])
+	assert.Equal(t, "ZFS-8000-4J", attrMap["msgid"])
+	assert.Equal(t, "https://openzfs.github.io/openzfs-docs/msg/ZFS-8000-4J", attrMap["moreinfo"])
+	assert.NotContains(t, attrMap["status"], "\t")
+
+	msgid := byUID[zpoolSensorUID(pool.PoolGUID, "msgid")]
+	assert.Equal(t, "enum", msgid.config.DeviceClass)
+	assert.Equal(t, []byte("ZFS-8000-4J"), msgid.payload())
+}
+
+func TestGetMsgID(t *testing.T) {
+	assert.Equal(t, "none", getMsgID(""))
+	assert.Equal(t, "ZFS-8000-K4", getMsgID("ZFS-8000-K4"))
+	assert.Equal(t, "other", getMsgID("ZFS-8000-XX"))
 }
 
 func TestNoScrubTimesWhenZero(t *testing.T) {
 	status, err := runZpool(context.Background(), zpoolFixtureExec(t, "zoolstatus2.json"))
 	require.NoError(t, err)
 	pool := status.Pools["test"] // no scan_stats
-	entries := buildPoolEntries(pool, 20*time.Minute)
+	entries := buildPoolEntries(pool, poolDisks{}, 20*time.Minute)
 	byUID := map[string]zpoolSensorEntry{}
 	for _, e := range entries {
 		byUID[e.config.UniqueID] = e
@@ -154,7 +175,7 @@ func TestZpoolDeviceIdentifierIsPureGUID(t *testing.T) {
 }
 
 func TestRunZpoolError(t *testing.T) {
-	provider := NewZpoolProvider(20 * time.Minute)
+	provider := NewZpoolProvider(models.ZFSdefault().Zpool, "", 20*time.Minute)
 	provider.execFn = func(_ context.Context, _ string, _ ...string) zpoolExecutor {
 		return &mockZpoolCmd{err: os.ErrNotExist}
 	}